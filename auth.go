@@ -0,0 +1,125 @@
+package gohans
+
+import (
+	"io"
+	"net/http"
+)
+
+// Authenticator adds credentials to the requests sent by a client
+type Authenticator interface {
+	// Authenticate adds credentials to an outgoing request
+	Authenticate(req *http.Request) error
+	// Challenge is called with a 401 Unauthorized response to an authenticated request
+	// It reports whether the request should be sent once more with fresh credentials
+	Challenge(resp *http.Response) bool
+}
+
+// WithAuthenticator authenticates every request sent by the client
+// Requests with an Authorization header already set, e.g. with SetAuthToken, are sent as is
+func WithAuthenticator(a Authenticator) RequestOption {
+	return func(c *Client) {
+		c.authenticator = a
+	}
+}
+
+// authenticate adds credentials to the request and sends it once more when they are rejected
+func (c *Client) authenticate(next RoundTripFunc) RoundTripFunc {
+	return func(r *Request, req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Authorization") != "" {
+			return next(r, req)
+		}
+
+		// Credentials are added to a copy, so they do not show up in errors built from the request
+		authed := req.Clone(req.Context())
+		if err := c.authenticator.Authenticate(authed); err != nil {
+			c.logger.Error("error authenticating request", "error", err)
+			return nil, err
+		}
+
+		resp, err := next(r, authed)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || !c.authenticator.Challenge(resp) {
+			return resp, err
+		}
+
+		retry, err := resend(req)
+		if err != nil {
+			// The body cannot be sent again, the 401 response is returned as is
+			return resp, nil
+		}
+
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+		resp.Body.Close()
+
+		if err := c.authenticator.Authenticate(retry); err != nil {
+			c.logger.Error("error authenticating request", "error", err)
+			return nil, err
+		}
+
+		c.logger.Warn("retrying request with fresh credentials", "url", redactURL(req.URL))
+
+		return next(r, retry)
+	}
+}
+
+// resend returns a copy of a sent request with a fresh body
+func resend(req *http.Request) (*http.Request, error) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, nil
+	}
+
+	if req.GetBody == nil {
+		return nil, BodyNotRewindableError
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	retry.Body = body
+
+	return retry, nil
+}
+
+// BasicAuth authenticates requests with a username and password, as defined by RFC 7617
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+
+	return nil
+}
+
+// Challenge reports false, the credentials cannot change
+func (a BasicAuth) Challenge(*http.Response) bool {
+	return false
+}
+
+// APIKey authenticates requests with a key sent in a header, or in a query parameter when InQuery is set
+type APIKey struct {
+	Name    string
+	Value   string
+	InQuery bool
+}
+
+func (a APIKey) Authenticate(req *http.Request) error {
+	if !a.InQuery {
+		req.Header.Set(a.Name, a.Value)
+		return nil
+	}
+
+	q := req.URL.Query()
+	q.Set(a.Name, a.Value)
+	req.URL.RawQuery = q.Encode()
+
+	return nil
+}
+
+// Challenge reports false, the key cannot change
+func (a APIKey) Challenge(*http.Response) bool {
+	return false
+}
@@ -0,0 +1,211 @@
+package gohans
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// staticAuth hands out a new token each time it is challenged
+type staticAuth struct {
+	tokens     []string
+	current    atomic.Int32
+	challenges atomic.Int32
+	retry      bool
+	err        error
+}
+
+func (a *staticAuth) Authenticate(req *http.Request) error {
+	if a.err != nil {
+		return a.err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+a.tokens[a.current.Load()])
+
+	return nil
+}
+
+func (a *staticAuth) Challenge(resp *http.Response) bool {
+	a.challenges.Add(1)
+	if a.retry {
+		a.current.Add(1)
+	}
+
+	return a.retry
+}
+
+func TestWithAuthenticator(t *testing.T) {
+	ctx := context.Background()
+
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid token"}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	t.Run("authenticates requests", func(t *testing.T) {
+		bodies = nil
+		auth := &staticAuth{tokens: []string{"good"}}
+		client := NewClient(ctx, WithAuthenticator(auth))
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(0), auth.challenges.Load())
+	})
+
+	t.Run("retries once with fresh credentials", func(t *testing.T) {
+		bodies = nil
+		auth := &staticAuth{tokens: []string{"expired", "good"}, retry: true}
+		client := NewClient(ctx, WithAuthenticator(auth))
+
+		_, err := NewRequest().SetMethod(http.MethodPost).SetURL(server.URL).SetRequestBody(map[string]string{"a": "b"}).Send(ctx, client)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), auth.challenges.Load())
+		assert.Len(t, bodies, 2)
+		assert.Equal(t, bodies[0], bodies[1])
+	})
+
+	t.Run("rejected credentials", func(t *testing.T) {
+		bodies = nil
+		auth := &staticAuth{tokens: []string{"bad", "worse", "worst"}, retry: true}
+		client := NewClient(ctx, WithAuthenticator(auth))
+
+		r := NewRequest().SetURL(server.URL)
+		_, err := r.Send(ctx, client)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+		assert.Equal(t, http.StatusUnauthorized, r.GetStatusCode())
+		assert.Len(t, bodies, 2)
+	})
+
+	t.Run("challenge declined", func(t *testing.T) {
+		bodies = nil
+		auth := &staticAuth{tokens: []string{"bad"}}
+		client := NewClient(ctx, WithAuthenticator(auth))
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+		assert.Equal(t, int32(1), auth.challenges.Load())
+		assert.Len(t, bodies, 1)
+	})
+
+	t.Run("authorization already set", func(t *testing.T) {
+		auth := &staticAuth{tokens: []string{"bad"}}
+		client := NewClient(ctx, WithAuthenticator(auth))
+
+		_, err := NewRequest().SetURL(server.URL).SetAuthToken("good").Send(ctx, client)
+		assert.NoError(t, err)
+	})
+
+	t.Run("authentication error", func(t *testing.T) {
+		authErr := errors.New("no credentials")
+		client := NewClient(ctx, WithAuthenticator(&staticAuth{err: authErr}))
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.ErrorIs(t, err, authErr)
+	})
+}
+
+func Test_resend(t *testing.T) {
+	t.Run("rewinds the body", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader("payload"))
+		_, _ = io.ReadAll(req.Body)
+
+		retry, err := resend(req)
+		assert.NoError(t, err)
+
+		body, _ := io.ReadAll(retry.Body)
+		assert.Equal(t, "payload", string(body))
+	})
+
+	t.Run("body not rewindable", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com", io.NopCloser(strings.NewReader("payload")))
+
+		_, err := resend(req)
+		assert.ErrorIs(t, err, BodyNotRewindableError)
+	})
+
+	t.Run("no body", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		retry, err := resend(req)
+		assert.NoError(t, err)
+		assert.Equal(t, req.URL, retry.URL)
+	})
+}
+
+func TestBasicAuth(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "p@ss:word", pass)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(ctx, WithAuthenticator(BasicAuth{Username: "user", Password: "p@ss:word"}))
+
+	_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+	assert.NoError(t, err)
+	assert.False(t, BasicAuth{}.Challenge(&http.Response{}))
+}
+
+func TestAPIKey(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "k3y" && r.URL.Query().Get("api-key") != "k3y" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		assert.Equal(t, "2", r.URL.Query().Get("page"))
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	t.Run("header", func(t *testing.T) {
+		client := NewClient(ctx, WithAuthenticator(APIKey{Name: "X-Api-Key", Value: "k3y"}))
+
+		_, err := NewRequest().SetURL(server.URL).SetQueryParam("page", "2").Send(ctx, client)
+		assert.NoError(t, err)
+	})
+
+	t.Run("query", func(t *testing.T) {
+		client := NewClient(ctx, WithAuthenticator(APIKey{Name: "api-key", Value: "k3y", InQuery: true}))
+
+		_, err := NewRequest().SetURL(server.URL).SetQueryParam("page", "2").Send(ctx, client)
+		assert.NoError(t, err)
+	})
+
+	t.Run("key is kept out of errors", func(t *testing.T) {
+		client := NewClient(ctx, WithAuthenticator(APIKey{Name: "api-key", Value: "wrong", InQuery: true}))
+
+		_, err := NewRequest().SetURL(server.URL).SetQueryParam("page", "2").Send(ctx, client)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+		assert.NotContains(t, err.Error(), "wrong")
+	})
+}
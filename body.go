@@ -0,0 +1,133 @@
+package gohans
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+var BodyNotRewindableError = errors.New("request body cannot be rewound")
+
+// bodyReader wraps a caller provided reader so it can be sent more than once
+// Seekable readers are rewound to their starting offset before every send after the first,
+// other readers can only be sent once
+type bodyReader struct {
+	r      io.Reader
+	size   int64
+	offset int64
+
+	mu      sync.Mutex
+	used    bool
+	current *attemptBody
+}
+
+// newBodyReader wraps a reader of the given size, -1 if unknown
+// The size of readers with a Len method, such as bytes.Reader, is detected when unknown
+func newBodyReader(r io.Reader, size int64) *bodyReader {
+	if size < 0 {
+		if l, ok := r.(interface{ Len() int }); ok {
+			size = int64(l.Len())
+		}
+	}
+
+	return &bodyReader{r: r, size: size}
+}
+
+// reader returns the body of a new attempt, positioned at the start of the body
+// The body of the previous attempt is closed first, waiting for a read in progress,
+// as the transport may still be writing it when a redirect or retry rewinds the reader
+func (b *bodyReader) reader() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current != nil {
+		b.current.Close()
+	}
+
+	s, seekable := b.r.(io.Seeker)
+
+	if !b.used {
+		b.used = true
+
+		if seekable {
+			offset, err := s.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+
+			b.offset = offset
+
+			if b.size < 0 {
+				end, err := s.Seek(0, io.SeekEnd)
+				if err != nil {
+					return nil, err
+				}
+
+				if _, err := s.Seek(offset, io.SeekStart); err != nil {
+					return nil, err
+				}
+
+				b.size = end - offset
+			}
+		}
+
+		b.current = &attemptBody{r: b.r}
+
+		return b.current, nil
+	}
+
+	if !seekable {
+		return nil, BodyNotRewindableError
+	}
+
+	if _, err := s.Seek(b.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	b.current = &attemptBody{r: b.r}
+
+	return b.current, nil
+}
+
+// rewindable reports whether the body can be sent again
+func (b *bodyReader) rewindable() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, seekable := b.r.(io.Seeker)
+
+	return !b.used || seekable
+}
+
+// getBody returns a GetBody function for http.Request, used by the http client to resend the body on redirects
+func (b *bodyReader) getBody() (io.ReadCloser, error) {
+	return b.reader()
+}
+
+// attemptBody is the body sent by a single attempt
+// Closing it leaves the caller's reader open, but stops the attempt from reading it any further
+type attemptBody struct {
+	mu     sync.Mutex
+	r      io.Reader
+	closed bool
+}
+
+func (a *attemptBody) Read(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return 0, http.ErrBodyReadAfterClose
+	}
+
+	return a.r.Read(p)
+}
+
+func (a *attemptBody) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package gohans
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bodyReader(t *testing.T) {
+	t.Run("size from Len", func(t *testing.T) {
+		assert.Equal(t, int64(5), newBodyReader(bytes.NewBufferString("hello"), -1).size)
+		assert.Equal(t, int64(3), newBodyReader(strings.NewReader("hello"), 3).size)
+		assert.Equal(t, int64(-1), newBodyReader(io.LimitReader(zeroReader{}, 4), -1).size)
+	})
+
+	t.Run("rewind seekable reader", func(t *testing.T) {
+		r := strings.NewReader("skip:body")
+		_, _ = r.Seek(5, io.SeekStart)
+
+		b := newBodyReader(io.Reader(struct {
+			io.Reader
+			io.Seeker
+		}{r, r}), -1)
+
+		rd, err := b.reader()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), b.size)
+		data, _ := io.ReadAll(rd)
+		assert.Equal(t, "body", string(data))
+		assert.True(t, b.rewindable())
+
+		next, err := b.reader()
+		assert.NoError(t, err)
+
+		// The previous attempt no longer reads the rewound reader
+		_, err = rd.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, http.ErrBodyReadAfterClose)
+
+		data, _ = io.ReadAll(next)
+		assert.Equal(t, "body", string(data))
+	})
+
+	t.Run("non seekable reader is sent once", func(t *testing.T) {
+		b := newBodyReader(io.LimitReader(zeroReader{}, 4), -1)
+		assert.True(t, b.rewindable())
+
+		_, err := b.reader()
+		assert.NoError(t, err)
+		assert.False(t, b.rewindable())
+
+		_, err = b.reader()
+		assert.ErrorIs(t, err, BodyNotRewindableError)
+
+		_, err = b.getBody()
+		assert.ErrorIs(t, err, BodyNotRewindableError)
+	})
+}
@@ -0,0 +1,353 @@
+package gohans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending the request when the circuit of the host is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	DefaultFailureRatio    = 0.5
+	DefaultMinRequests     = 10
+	DefaultCircuitWindow   = time.Minute
+	DefaultCircuitCoolDown = 30 * time.Second
+
+	// circuitBuckets is the number of buckets of the rolling window
+	circuitBuckets = 10
+)
+
+// CircuitState is the state of the circuit of a host
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through and counts their failures
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests fast until the cool-down is over
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through to decide whether to close or open again
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker configures the circuit breakers of a client, one per host
+type CircuitBreaker struct {
+	// FailureRatio opens the circuit when the ratio of failed requests in the window reaches it, 0.5 by default
+	FailureRatio float64
+	// MinRequests is the number of requests in the window before the ratio is considered, 10 by default
+	MinRequests int
+	// Window is the duration of the rolling window failures are counted in, 1 minute by default
+	Window time.Duration
+	// CoolDown is how long an open circuit fails requests before letting probes through, 30 seconds by default
+	CoolDown time.Duration
+	// Probes is the number of successful probe requests closing a half-open circuit, 1 by default
+	// A single failed probe opens the circuit again
+	Probes int
+	// IsFailure reports whether a request failed, by default on transport errors and 5xx status codes
+	// Requests canceled by their context, or failing before they reach the transport, are not counted
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange is called after the circuit of a host changes state
+	OnStateChange func(host string, from, to CircuitState)
+}
+
+// withDefaults returns a copy of the breaker config with defaults applied
+func (cb CircuitBreaker) withDefaults() CircuitBreaker {
+	if cb.FailureRatio <= 0 {
+		cb.FailureRatio = DefaultFailureRatio
+	}
+
+	if cb.MinRequests <= 0 {
+		cb.MinRequests = DefaultMinRequests
+	}
+
+	if cb.Window <= 0 {
+		cb.Window = DefaultCircuitWindow
+	}
+
+	if cb.CoolDown <= 0 {
+		cb.CoolDown = DefaultCircuitCoolDown
+	}
+
+	if cb.Probes <= 0 {
+		cb.Probes = 1
+	}
+
+	if cb.IsFailure == nil {
+		cb.IsFailure = func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode >= http.StatusInternalServerError
+		}
+	}
+
+	return cb
+}
+
+// WithCircuitBreaker adds a circuit breaker per host to the client
+// Requests to a host whose circuit is open fail with ErrCircuitOpen without touching the network
+func WithCircuitBreaker(cb CircuitBreaker) RequestOption {
+	return func(c *Client) {
+		c.breakers = &breakers{config: cb.withDefaults(), circuits: map[string]*circuit{}}
+	}
+}
+
+// CircuitState returns the state of the circuit of a host, closed if the client has no circuit breaker
+func (c *Client) CircuitState(host string) CircuitState {
+	if c.breakers == nil {
+		return CircuitClosed
+	}
+
+	c.breakers.mu.Lock()
+	circuit, ok := c.breakers.circuits[host]
+	c.breakers.mu.Unlock()
+
+	if !ok {
+		return CircuitClosed
+	}
+
+	return circuit.currentState(time.Now(), c.breakers.config)
+}
+
+// breakers holds the circuits of a client by host
+type breakers struct {
+	config CircuitBreaker
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+func (b *breakers) circuit(host string) *circuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+
+	return c
+}
+
+// wrap fails fast when the circuit of the request host is open, and records the outcome of sent requests
+func (b *breakers) wrap(next RoundTripFunc, logger *slog.Logger) RoundTripFunc {
+	return func(r *Request, req *http.Request) (*http.Response, error) {
+		host := req.URL.Host
+		c := b.circuit(host)
+
+		probe, change, err := c.allow(time.Now(), b.config)
+		b.changed(logger, host, change)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, host)
+		}
+
+		var sent atomic.Bool
+		req = req.WithContext(context.WithValue(req.Context(), sentKey{}, &sent))
+
+		resp, err := next(r, req)
+
+		// Requests canceled or rejected before reaching the transport, by a full bulkhead queue,
+		// a signer or an authenticator, say nothing about the host
+		if err != nil && (req.Context().Err() != nil || !sent.Load()) {
+			c.release(probe)
+
+			return resp, err
+		}
+
+		change = c.record(time.Now(), b.config, probe, b.config.IsFailure(resp, err))
+		b.changed(logger, host, change)
+
+		return resp, err
+	}
+}
+
+// sentKey is the context key of the flag set when a request reaches the transport
+type sentKey struct{}
+
+// markSent records that the request of the context reached the transport
+func markSent(ctx context.Context) {
+	if sent, ok := ctx.Value(sentKey{}).(*atomic.Bool); ok {
+		sent.Store(true)
+	}
+}
+
+func (b *breakers) changed(logger *slog.Logger, host string, change *transition) {
+	if change == nil {
+		return
+	}
+
+	logger.Warn("circuit breaker state changed", "host", host, "from", change.from.String(), "to", change.to.String())
+
+	if b.config.OnStateChange != nil {
+		b.config.OnStateChange(host, change.from, change.to)
+	}
+}
+
+type transition struct {
+	from, to CircuitState
+}
+
+// circuit is the circuit breaker of a single host
+type circuit struct {
+	mu       sync.Mutex
+	state    CircuitState
+	openedAt time.Time
+	buckets  [circuitBuckets]windowBucket
+	// probes is the number of probes in flight, and successes the number of successful ones
+	probes    int
+	successes int
+}
+
+// windowBucket counts the requests of a slice of the rolling window
+type windowBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// currentState returns the state, reporting an open circuit as half-open once the cool-down is over
+// The circuit itself only moves on the next request, so the transition is logged and reported once
+func (c *circuit) currentState(now time.Time, config CircuitBreaker) CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == CircuitOpen && now.Sub(c.openedAt) >= config.CoolDown {
+		return CircuitHalfOpen
+	}
+
+	return c.state
+}
+
+func (c *circuit) coolDown(now time.Time, config CircuitBreaker) *transition {
+	if c.state != CircuitOpen || now.Sub(c.openedAt) < config.CoolDown {
+		return nil
+	}
+
+	return c.set(CircuitHalfOpen, now)
+}
+
+// allow reports whether a request can be sent, and whether it is a probe of a half-open circuit
+func (c *circuit) allow(now time.Time, config CircuitBreaker) (probe bool, change *transition, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	change = c.coolDown(now, config)
+
+	switch c.state {
+	case CircuitOpen:
+		return false, change, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if c.probes+c.successes >= config.Probes {
+			return false, change, ErrCircuitOpen
+		}
+
+		c.probes++
+
+		return true, change, nil
+	}
+
+	return false, change, nil
+}
+
+// release gives back the slot of a probe whose outcome is not counted
+func (c *circuit) release(probe bool) {
+	if !probe {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+// record counts the outcome of a request and returns the state transition it caused, if any
+func (c *circuit) record(now time.Time, config CircuitBreaker, probe, failed bool) *transition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if probe {
+		// The circuit may have been opened again by another probe
+		if c.state != CircuitHalfOpen {
+			return nil
+		}
+
+		c.probes--
+		if failed {
+			return c.set(CircuitOpen, now)
+		}
+
+		c.successes++
+		if c.successes >= config.Probes {
+			return c.set(CircuitClosed, now)
+		}
+
+		return nil
+	}
+
+	if c.state != CircuitClosed {
+		return nil
+	}
+
+	width := config.Window / circuitBuckets
+	start := now.Truncate(width)
+	b := &c.buckets[(now.UnixNano()/int64(width))%circuitBuckets]
+	if !b.start.Equal(start) {
+		*b = windowBucket{start: start}
+	}
+
+	b.total++
+	if failed {
+		b.failures++
+	}
+
+	var total, failures int
+	for _, b := range c.buckets {
+		if now.Sub(b.start) < config.Window {
+			total += b.total
+			failures += b.failures
+		}
+	}
+
+	if total >= config.MinRequests && float64(failures)/float64(total) >= config.FailureRatio {
+		return c.set(CircuitOpen, now)
+	}
+
+	return nil
+}
+
+// set moves the circuit to a new state, resetting the counters of the state it enters
+func (c *circuit) set(state CircuitState, now time.Time) *transition {
+	change := &transition{from: c.state, to: state}
+	c.state = state
+	c.probes = 0
+	c.successes = 0
+
+	switch state {
+	case CircuitOpen:
+		c.openedAt = now
+	case CircuitClosed:
+		c.buckets = [circuitBuckets]windowBucket{}
+	}
+
+	return change
+}
@@ -0,0 +1,169 @@
+package gohans
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitState_String(t *testing.T) {
+	assert.Equal(t, "closed", CircuitClosed.String())
+	assert.Equal(t, "open", CircuitOpen.String())
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+	assert.Equal(t, "CircuitState(7)", CircuitState(7).String())
+}
+
+func TestCircuitBreaker_withDefaults(t *testing.T) {
+	cb := CircuitBreaker{}.withDefaults()
+
+	assert.Equal(t, DefaultFailureRatio, cb.FailureRatio)
+	assert.Equal(t, DefaultMinRequests, cb.MinRequests)
+	assert.Equal(t, DefaultCircuitWindow, cb.Window)
+	assert.Equal(t, DefaultCircuitCoolDown, cb.CoolDown)
+	assert.Equal(t, 1, cb.Probes)
+	assert.True(t, cb.IsFailure(&http.Response{StatusCode: http.StatusBadGateway}, nil))
+	assert.False(t, cb.IsFailure(&http.Response{StatusCode: http.StatusNotFound}, nil))
+	assert.True(t, cb.IsFailure(nil, context.DeadlineExceeded))
+}
+
+func Test_circuit(t *testing.T) {
+	config := CircuitBreaker{FailureRatio: 0.5, MinRequests: 4, Window: 10 * time.Second, CoolDown: 5 * time.Second, Probes: 2}.withDefaults()
+	now := time.Now()
+
+	t.Run("opens on failure ratio", func(t *testing.T) {
+		c := &circuit{}
+
+		assert.Nil(t, c.record(now, config, false, true))
+		assert.Nil(t, c.record(now, config, false, false))
+		assert.Nil(t, c.record(now, config, false, false))
+		assert.Equal(t, &transition{CircuitClosed, CircuitOpen}, c.record(now, config, false, true))
+
+		_, _, err := c.allow(now, config)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+	})
+
+	t.Run("old failures leave the window", func(t *testing.T) {
+		c := &circuit{}
+
+		c.record(now, config, false, true)
+		c.record(now, config, false, true)
+		c.record(now, config, false, true)
+
+		assert.Nil(t, c.record(now.Add(20*time.Second), config, false, true))
+		assert.Equal(t, CircuitClosed, c.state)
+	})
+
+	t.Run("half open probes", func(t *testing.T) {
+		c := &circuit{state: CircuitOpen, openedAt: now}
+
+		later := now.Add(6 * time.Second)
+
+		// Reading the state leaves the transition to the next request
+		assert.Equal(t, CircuitHalfOpen, c.currentState(later, config))
+		assert.Equal(t, CircuitOpen, c.state)
+
+		probe, change, err := c.allow(later, config)
+		assert.NoError(t, err)
+		assert.True(t, probe)
+		assert.Equal(t, &transition{CircuitOpen, CircuitHalfOpen}, change)
+
+		probe, _, err = c.allow(later, config)
+		assert.NoError(t, err)
+		assert.True(t, probe)
+
+		// Only the configured number of probes is let through
+		_, _, err = c.allow(later, config)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+
+		assert.Nil(t, c.record(later, config, true, false))
+		assert.Equal(t, &transition{CircuitHalfOpen, CircuitClosed}, c.record(later, config, true, false))
+	})
+
+	t.Run("failed probe opens again", func(t *testing.T) {
+		c := &circuit{state: CircuitHalfOpen}
+
+		probe, _, err := c.allow(now, config)
+		assert.NoError(t, err)
+
+		assert.Equal(t, &transition{CircuitHalfOpen, CircuitOpen}, c.record(now, config, probe, true))
+		assert.Equal(t, now, c.openedAt)
+	})
+
+	t.Run("released probe", func(t *testing.T) {
+		c := &circuit{state: CircuitHalfOpen}
+
+		probe, _, _ := c.allow(now, config)
+		c.release(probe)
+		assert.Equal(t, 0, c.probes)
+	})
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	var failing atomic.Bool
+	failing.Store(true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+
+	var mu sync.Mutex
+	var changes []CircuitState
+
+	client := NewClient(ctx, WithCircuitBreaker(CircuitBreaker{
+		MinRequests: 3,
+		CoolDown:    100 * time.Millisecond,
+		OnStateChange: func(host string, from, to CircuitState) {
+			assert.Equal(t, u.Host, host)
+
+			mu.Lock()
+			changes = append(changes, to)
+			mu.Unlock()
+		},
+	}))
+
+	for range 3 {
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+	}
+
+	assert.Equal(t, CircuitOpen, client.CircuitState(u.Host))
+
+	// Open circuits fail fast, without sending the request
+	_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), calls.Load())
+
+	time.Sleep(150 * time.Millisecond)
+	failing.Store(false)
+	assert.Equal(t, CircuitHalfOpen, client.CircuitState(u.Host))
+
+	_, err = NewRequest().SetURL(server.URL).Send(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, client.CircuitState(u.Host))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}, changes)
+
+	assert.Equal(t, CircuitClosed, NewClient(ctx).CircuitState(u.Host))
+}
@@ -0,0 +1,146 @@
+package gohans
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+var QueueFullError = errors.New("request queue is full")
+
+// Concurrency bounds the requests a client has in flight
+// A request is in flight from the time it is sent until its response body is closed
+type Concurrency struct {
+	// Max is the number of requests in flight across all hosts, zero for no limit
+	Max int
+	// MaxPerHost is the number of requests in flight to a single host, zero for no limit
+	MaxPerHost int
+	// MaxQueue is the number of requests waiting for a slot, zero for no limit
+	// Requests beyond it fail with QueueFullError instead of waiting
+	MaxQueue int
+}
+
+// WithMaxConcurrency bounds the requests the client has in flight
+// Requests wait for a slot until their context is done
+func WithMaxConcurrency(limit Concurrency) RequestOption {
+	return func(c *Client) {
+		if limit.Max <= 0 && limit.MaxPerHost <= 0 {
+			c.bulkhead = nil
+			return
+		}
+
+		b := &bulkhead{limit: limit, hosts: map[string]chan struct{}{}}
+		if limit.Max > 0 {
+			b.global = make(chan struct{}, limit.Max)
+		}
+
+		c.bulkhead = b
+	}
+}
+
+// bulkhead holds the slots of the requests in flight as buffered channels
+type bulkhead struct {
+	limit   Concurrency
+	global  chan struct{}
+	waiting atomic.Int64
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// wrap holds a slot from sending the request until its response body is closed
+func (b *bulkhead) wrap(next RoundTripFunc) RoundTripFunc {
+	return func(r *Request, req *http.Request) (*http.Response, error) {
+		release, err := b.acquire(req.Context(), req.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := next(r, req)
+		if err != nil {
+			release()
+
+			return resp, err
+		}
+
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+
+		return resp, nil
+	}
+}
+
+// acquire takes a slot for the host, and a global one, waiting in the queue when none is free
+func (b *bulkhead) acquire(ctx context.Context, host string) (func(), error) {
+	var held []chan struct{}
+	release := func() {
+		for _, slots := range held {
+			<-slots
+		}
+	}
+
+	// Host slots are taken first, so a request waiting for a busy host does not hold a global slot
+	for _, slots := range []chan struct{}{b.hostSlots(host), b.global} {
+		if slots == nil {
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+			held = append(held, slots)
+			continue
+		default:
+		}
+
+		if waiting := b.waiting.Add(1); b.limit.MaxQueue > 0 && waiting > int64(b.limit.MaxQueue) {
+			b.waiting.Add(-1)
+			release()
+
+			return nil, QueueFullError
+		}
+
+		select {
+		case slots <- struct{}{}:
+			b.waiting.Add(-1)
+			held = append(held, slots)
+		case <-ctx.Done():
+			b.waiting.Add(-1)
+			release()
+
+			return nil, ctx.Err()
+		}
+	}
+
+	return sync.OnceFunc(release), nil
+}
+
+func (b *bulkhead) hostSlots(host string) chan struct{} {
+	if b.limit.MaxPerHost <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slots, ok := b.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, b.limit.MaxPerHost)
+		b.hosts[host] = slots
+	}
+
+	return slots
+}
+
+// releaseBody releases the slot of a request when its response body is closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+
+	return b.ReadCloser.Close()
+}
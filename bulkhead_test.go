@@ -0,0 +1,243 @@
+package gohans
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMaxConcurrency(t *testing.T) {
+	ctx := context.Background()
+
+	client := NewClient(ctx, WithMaxConcurrency(Concurrency{Max: 2}))
+	assert.NotNil(t, client.bulkhead)
+	assert.Equal(t, 2, cap(client.bulkhead.global))
+
+	client = NewClient(ctx, WithMaxConcurrency(Concurrency{MaxPerHost: 2}))
+	assert.Nil(t, client.bulkhead.global)
+
+	client = NewClient(ctx, WithMaxConcurrency(Concurrency{Max: 2}), WithMaxConcurrency(Concurrency{}))
+	assert.Nil(t, client.bulkhead)
+}
+
+// concurrencyServer records the highest number of requests it handled at once
+// Requests block until release is closed
+func concurrencyServer(release chan struct{}) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	var current, highest atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		defer current.Add(-1)
+
+		for {
+			h := highest.Load()
+			if n <= h || highest.CompareAndSwap(h, n) {
+				break
+			}
+		}
+
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return server, &current, &highest
+}
+
+func TestClient_MaxConcurrency(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("bounds requests in flight", func(t *testing.T) {
+		release := make(chan struct{})
+		server, _, highest := concurrencyServer(release)
+		defer server.Close()
+
+		client := NewClient(ctx, WithMaxConcurrency(Concurrency{Max: 2}))
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+				assert.NoError(t, err)
+			}()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int32(2), highest.Load())
+		assert.Zero(t, len(client.bulkhead.global))
+	})
+
+	t.Run("per host", func(t *testing.T) {
+		release := make(chan struct{})
+		server, current, _ := concurrencyServer(release)
+		defer server.Close()
+
+		client := NewClient(ctx, WithMaxConcurrency(Concurrency{MaxPerHost: 1}))
+		other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+		var wg sync.WaitGroup
+		for _, u := range []string{server.URL, server.URL, other} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := NewRequest().SetURL(u).Send(ctx, client)
+				assert.NoError(t, err)
+			}()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, int32(2), current.Load())
+
+		close(release)
+		wg.Wait()
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		release := make(chan struct{})
+		server, current, _ := concurrencyServer(release)
+		defer server.Close()
+
+		client := NewClient(ctx, WithMaxConcurrency(Concurrency{Max: 1, MaxQueue: 1}))
+
+		var wg sync.WaitGroup
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+				assert.NoError(t, err)
+			}()
+		}
+
+		assert.Eventually(t, func() bool {
+			return current.Load() == 1 && client.bulkhead.waiting.Load() == 1
+		}, time.Second, time.Millisecond)
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.ErrorIs(t, err, QueueFullError)
+
+		close(release)
+		wg.Wait()
+	})
+
+	t.Run("queue full does not open the circuit", func(t *testing.T) {
+		release := make(chan struct{})
+		server, current, _ := concurrencyServer(release)
+		defer server.Close()
+
+		client := NewClient(ctx,
+			WithMaxConcurrency(Concurrency{Max: 1, MaxQueue: 1}),
+			WithCircuitBreaker(CircuitBreaker{MinRequests: 2}),
+		)
+
+		var wg sync.WaitGroup
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+				assert.NoError(t, err)
+			}()
+		}
+
+		assert.Eventually(t, func() bool {
+			return current.Load() == 1 && client.bulkhead.waiting.Load() == 1
+		}, time.Second, time.Millisecond)
+
+		for range 2 {
+			_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+			assert.ErrorIs(t, err, QueueFullError)
+		}
+
+		close(release)
+		wg.Wait()
+
+		host := strings.TrimPrefix(server.URL, "http://")
+		assert.Equal(t, CircuitClosed, client.CircuitState(host))
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.NoError(t, err)
+	})
+
+	t.Run("context done while waiting", func(t *testing.T) {
+		release := make(chan struct{})
+		server, current, _ := concurrencyServer(release)
+		defer server.Close()
+
+		client := NewClient(ctx, WithMaxConcurrency(Concurrency{Max: 1}))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+			assert.NoError(t, err)
+		}()
+
+		assert.Eventually(t, func() bool { return current.Load() == 1 }, time.Second, time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Zero(t, client.bulkhead.waiting.Load())
+
+		close(release)
+		<-done
+	})
+
+	t.Run("resumed download", func(t *testing.T) {
+		content := bytes.Repeat([]byte("0123456789"), 10000)
+
+		var calls atomic.Int32
+		server := rangeServer(content, true, &calls)
+		defer server.Close()
+
+		client := NewClient(ctx, WithMaxConcurrency(Concurrency{Max: 1}))
+
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+
+		// The interrupted response releases its slot for the Range request
+		var buf bytes.Buffer
+		_, err := NewRequest().SetURL(server.URL).SetResponseWriter(&buf).SetResumeAttempts(1).Send(ctx, client)
+		assert.NoError(t, err)
+		assert.Equal(t, content, buf.Bytes())
+		assert.Equal(t, int32(2), calls.Load())
+		assert.Zero(t, len(client.bulkhead.global))
+	})
+
+	t.Run("slot held until body is closed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := NewClient(ctx, WithMaxConcurrency(Concurrency{Max: 1}))
+
+		resp, err := client.stream(ctx, NewRequest().SetURL(server.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(client.bulkhead.global))
+
+		assert.NoError(t, resp.Body.Close())
+		assert.NoError(t, resp.Body.Close())
+		assert.Zero(t, len(client.bulkhead.global))
+	})
+}
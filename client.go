@@ -4,12 +4,13 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -19,17 +20,35 @@ var (
 	MissingURLError           = errors.New("URL is missing")
 )
 
+// maxErrorBodySize limits how much of an error body is read from a streamed response
+const maxErrorBodySize = 1 << 20
+
 type RequestOption func(*Client)
 
 type Client struct {
 	logger *slog.Logger
 
-	httpClient *http.Client
+	httpClient    *http.Client
+	codecs        codecRegistry
+	retryPolicy   *RetryPolicy
+	middleware    []Middleware
+	rateLimiter   *rateLimiter
+	breakers      *breakers
+	bulkhead      *bulkhead
+	authenticator Authenticator
+	signer        *MessageSigner
+	baseURL       *url.URL
+
+	defaultHeaders http.Header
+
+	// err records an invalid option, it is returned when a request is sent
+	err error
 }
 
 func NewClient(ctx context.Context, opts ...RequestOption) *Client {
 	c := &Client{
 		httpClient: &http.Client{},
+		codecs:     defaultCodecs(),
 	}
 
 	for _, opt := range opts {
@@ -80,74 +99,421 @@ func WithLogger(logger *slog.Logger) RequestOption {
 	}
 }
 
+// WithCodec registers a codec for each of its content types
+// Codecs registered this way take precedence over the built-in JSON and XML codecs
+func WithCodec(codec Codec) RequestOption {
+	return func(c *Client) {
+		c.codecs.register(codec)
+	}
+}
+
+// WithBaseURL sets the URL that request URLs and paths are resolved against
+// The base path is treated as a directory, so "https://api.example.com/v1" and a SetPath path
+// "users/1" or "/users/1" resolve to "https://api.example.com/v1/users/1", keeping the base query
+// SetURL values are resolved like links instead: "users/1" resolves below the base path, but "/users/1"
+// replaces it with "https://api.example.com/users/1", and neither keeps the base query
+// Absolute request URLs override the base URL
+func WithBaseURL(baseURL string) RequestOption {
+	return func(c *Client) {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			c.err = err
+
+			return
+		}
+
+		c.baseURL = asDirectory(u)
+	}
+}
+
+// WithDefaultHeaders sets headers added to every request that does not set them itself
+func WithDefaultHeaders(headers http.Header) RequestOption {
+	return func(c *Client) {
+		c.defaultHeaders = http.Header{}
+		for k, v := range headers {
+			c.defaultHeaders[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+		}
+	}
+}
+
+// WithRetryPolicy sets the default retry policy for requests sent with Request.Send
+func WithRetryPolicy(policy *RetryPolicy) RequestOption {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
 // Do sends a request adds the decoded values from the response to the request object
 // Returns the response body as a byte slice for debugging or further processing
+// The request body is encoded with the codec matching the request Content-Type,
+// and the response body is decoded with the codec matching the response Content-Type
 // If the response status code is not the expected status code, we try to decode the response body into the error response object
-// If the response body cannot be decoded into the error response object, we return an error
-
+// and return an *HTTPError wrapping UnexpectedStatusCodeError
+// If the response body cannot be decoded into the error response object, the decoding error is joined to the *HTTPError
 func (c *Client) Do(ctx context.Context, r *Request) ([]byte, error) {
-	var br bytes.Buffer
+	resp, err := c.Execute(ctx, r)
+	if resp == nil {
+		return nil, err
+	}
 
-	if r.URL == "" {
-		c.logger.Error("URL is not set")
+	return resp.Body, err
+}
 
-		return nil, MissingURLError
+// Execute sends a request like Do, but returns the full response
+// The response is nil if the request could not be sent
+func (c *Client) Execute(ctx context.Context, r *Request) (*Response, error) {
+	req, err := c.newHTTPRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.download.streaming() {
+		r.download.prepare(req)
+	}
+
+	t := &timer{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.trace()))
+
+	resp, err := c.roundTrip(r, req)
+	if err == nil && r.download.streaming() && r.download.mismatched(resp) {
+		// The partial file belongs to another version of the resource, which is downloaded again in full
+		resp.Body.Close()
+
+		if req, err = r.download.restart(req); err == nil {
+			resp, err = c.roundTrip(r, req)
+		}
 	}
 
-	url, err := url.Parse(r.URL)
 	if err != nil {
-		c.logger.Error("Malformed URL", "url", r.URL)
+		c.logger.Error("error sending request", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	r.statusCode = resp.StatusCode
+	r.responseHeader = resp.Header
+
+	res := &Response{
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Header:     resp.Header,
+		URL:        req.URL,
+	}
 
+	// The request of the response is the last one sent when following redirects
+	if resp.Request != nil {
+		res.URL = resp.Request.URL
+	}
+
+	if r.download.streaming() && r.download.accepts(resp, r.expectedStatusCode) {
+		err = c.download(r, req, resp)
+		res.Trailer = resp.Trailer
+		res.Timings = t.timings()
+		if err != nil {
+			c.logger.Error("error downloading response", "error", err)
+		}
+
+		return res, err
+	}
+
+	res.Body, err = io.ReadAll(resp.Body)
+	res.Trailer = resp.Trailer
+	res.Timings = t.timings()
+	if err != nil {
+		c.logger.Error("error reading response", "error", err)
+		return res, err
+	}
+
+	if resp.StatusCode != r.expectedStatusCode {
+		err = c.statusError(r, req, resp, res.Body)
+
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.ErrorBody != nil {
+			res.Decoded = httpErr.ErrorBody
+		}
+
+		return res, err
+	}
+
+	if len(res.Body) == 0 {
+		return res, nil
+	}
+
+	err = decodeResponse(c.codecs, resp, bytes.NewReader(res.Body), decodeTarget(&r.response), c.fallbackTypes(r)...)
+	if err != nil {
+		c.logger.Error("error decoding response", "error", err)
+
+		return res, err
+	}
+
+	res.Decoded = r.response
+
+	return res, nil
+}
+
+// statusError returns the error for a response with an unexpected status code
+// The body is decoded into the error response body of the request when possible
+func (c *Client) statusError(r *Request, req *http.Request, resp *http.Response, body []byte) error {
+	c.logger.Error("unexpected status code", "expected", r.expectedStatusCode, "actual", resp.StatusCode)
+
+	httpErr := &HTTPError{
+		Method:     r.Method,
+		URL:        redactURL(req.URL),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}
+
+	if len(body) == 0 {
+		return httpErr
+	}
+
+	// Responses without a known Content-Type are decoded as the requested type
+	fallbacks := c.fallbackTypes(r)
+
+	err := decodeResponse(c.codecs, resp, bytes.NewReader(body), decodeTarget(&r.errorResponse), fallbacks...)
+	if err != nil {
+		c.logger.Error("error decoding error response", "error", err)
+		return errors.Join(httpErr, err)
+	}
+
+	httpErr.ErrorBody = r.errorResponse
+
+	return httpErr
+}
+
+// stream sends the request and returns the response with its body left open for streaming
+// On an unexpected status code the body is read and closed, and the response is returned with the error
+func (c *Client) stream(ctx context.Context, r *Request) (*http.Response, error) {
+	req, err := c.newHTTPRequest(ctx, r)
+	if err != nil {
 		return nil, err
 	}
 
-	if r.Body != nil {
-		err := json.NewEncoder(&br).Encode(r.Body)
+	resp, err := c.roundTrip(r, req)
+	if err != nil {
+		c.logger.Error("error sending request", "error", err)
+		return nil, err
+	}
+
+	r.statusCode = resp.StatusCode
+	r.responseHeader = resp.Header
+
+	if resp.StatusCode != r.expectedStatusCode {
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		if err != nil {
+			return resp, err
+		}
+
+		return resp, c.statusError(r, req, resp, body)
+	}
+
+	return resp, nil
+}
+
+// newHTTPRequest builds the outgoing http request for r
+func (c *Client) newHTTPRequest(ctx context.Context, r *Request) (*http.Request, error) {
+	var br bytes.Buffer
+
+	if c.err != nil {
+		c.logger.Error("invalid client configuration", "error", c.err)
+
+		return nil, c.err
+	}
+
+	if r.err != nil {
+		c.logger.Error("invalid request", "error", r.err)
+
+		return nil, r.err
+	}
+
+	url, err := c.requestURL(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parameters set on the request replace those of the same key in the URL
+	if len(r.query) > 0 {
+		q := url.Query()
+		for k, v := range r.query {
+			q[k] = v
+		}
+
+		url.RawQuery = q.Encode()
+	}
+
+	header := c.requestHeader(r)
+
+	var body io.Reader = &br
+	var mp *multipartBody
+	var stream *bodyReader
+
+	switch {
+	case len(r.multipart) > 0:
+		// The previous attempt may still be writing the parts
+		if r.multipartSent != nil {
+			r.multipartSent.release()
+		}
+
+		mp, err = newMultipartBody(r.multipart, "")
+		if err != nil {
+			c.logger.Error("error preparing multipart body", "error", err)
+			return nil, err
+		}
+
+		r.multipartSent = mp
+
+		body = mp
+	case r.streamedBody() != nil:
+		stream = r.streamedBody()
+
+		rd, err := stream.reader()
+		if err != nil {
+			c.logger.Error("error preparing request body", "error", err)
+			return nil, err
+		}
+
+		// Closing the attempt body leaves the reader of the caller open
+		body = rd
+	case r.Body != nil:
+		codec, ok := c.codecs.lookup(header.Get("Content-Type"))
+		if !ok {
+			c.logger.Error("no codec for request content type", "content_type", header.Get("Content-Type"))
+			return nil, InvalidContentTypeError
+		}
+
+		err := codec.Encode(&br, r.Body)
 		if err != nil {
 			c.logger.Error("error encoding request body", "error", err)
 			return nil, err
 		}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, r.Method, url.String(), &br)
+	req, err := http.NewRequestWithContext(ctx, r.Method, url.String(), body)
 	if err != nil {
 		c.logger.Error("error creating request", "error", err)
 		return nil, err
 	}
 
+	switch {
+	case mp != nil:
+		req.GetBody = mp.getBody
+	case stream != nil && stream.size == 0:
+		req.Body = http.NoBody
+		req.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+	case stream != nil:
+		req.ContentLength = stream.size
+		req.GetBody = stream.getBody
+	}
+
+	req.Header = header
+
+	if mp != nil {
+		req.Header.Set("Content-Type", mp.ContentType())
+	}
+
+	return req, nil
+}
+
+// requestHeader returns the headers of r merged with the client default headers
+// Client defaults replace the headers still holding their NewRequest default, but not those set on the request
+func (c *Client) requestHeader(r *Request) http.Header {
+	header := make(http.Header, len(r.Headers)+len(c.defaultHeaders))
+	for k, v := range c.defaultHeaders {
+		header[k] = append([]string(nil), v...)
+	}
+
 	for k, v := range r.Headers {
-		req.Header.Add(k, v)
+		if _, ok := header[k]; ok && r.holdsDefault(k) {
+			continue
+		}
+
+		header[k] = append([]string(nil), v...)
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		c.logger.Error("error sending request", "error", err)
-		return nil, err
+	return header
+}
+
+// fallbackTypes returns the types responses without a known Content-Type are decoded as, the accepted then the sent one
+func (c *Client) fallbackTypes(r *Request) []string {
+	header := c.requestHeader(r)
+
+	return []string{firstMediaType(header.Get("Accept")), header.Get("Content-Type")}
+}
+
+// requestURL resolves the request URL and path template against the client base URL
+// Each of them is optional, but at least one must be set
+func (c *Client) requestURL(r *Request) (*url.URL, error) {
+	u := c.baseURL
+
+	if r.URL != "" {
+		ref, err := url.Parse(r.URL)
+		if err != nil {
+			c.logger.Error("Malformed URL", "url", r.URL)
+
+			return nil, err
+		}
+
+		u = resolve(u, ref)
 	}
-	defer resp.Body.Close()
 
-	var buf bytes.Buffer
-	tee := io.TeeReader(resp.Body, &buf)
+	if r.path != "" {
+		path, err := expandPath(r.path, r.pathParams)
+		if err != nil {
+			c.logger.Error("invalid path", "path", r.path, "error", err)
 
-	r.statusCode = resp.StatusCode
+			return nil, err
+		}
 
-	if resp.StatusCode != r.expectedStatusCode {
-		c.logger.Error("unexpected status code", "expected", r.expectedStatusCode, "actual", resp.StatusCode)
-		err = json.NewDecoder(tee).Decode(&r.errorResponse)
+		// The ./ prefix keeps a colon in the first segment from being parsed as a scheme
+		ref, err := url.Parse("./" + path)
 		if err != nil {
-			c.logger.Error("error decoding error response", "error", err)
-			return buf.Bytes(), err
+			c.logger.Error("Malformed path", "path", path)
+
+			return nil, err
 		}
 
-		return buf.Bytes(), UnexpectedStatusCodeError
+		if u != nil {
+			// Paths are joined below the URL path and keep its query
+			ref.RawQuery = u.RawQuery
+			u = asDirectory(u)
+		}
+
+		u = resolve(u, ref)
 	}
 
-	err = json.NewDecoder(tee).Decode(&r.response)
-	if err != nil {
-		c.logger.Error("error decoding response", "error", err)
+	if u == nil {
+		c.logger.Error("URL is not set")
+
+		return nil, MissingURLError
+	}
+
+	// Copy so that setting the query does not alter the base URL
+	resolved := *u
+
+	return &resolved, nil
+}
+
+// asDirectory returns a copy of the URL with a trailing slash, so relative paths resolve below it
+func asDirectory(u *url.URL) *url.URL {
+	d := *u
+	if !strings.HasSuffix(d.Path, "/") {
+		d.Path += "/"
+		if d.RawPath != "" {
+			d.RawPath += "/"
+		}
+	}
+
+	return &d
+}
 
-		return buf.Bytes(), err
+// resolve resolves ref against base, or returns ref if there is no base
+func resolve(base, ref *url.URL) *url.URL {
+	if base == nil {
+		return ref
 	}
 
-	return buf.Bytes(), nil
+	return base.ResolveReference(ref)
 }
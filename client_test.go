@@ -2,6 +2,8 @@ package gohans
 
 import (
 	"crypto/tls"
+	"encoding/xml"
+	"io"
 	"log/slog"
 	"math"
 	"net/http"
@@ -54,6 +56,155 @@ func TestWithLogger(t *testing.T) {
 	assert.Equal(t, client.logger, logger)
 }
 
+func TestWithCodec(t *testing.T) {
+	ctx := context.Background()
+
+	client := NewClient(ctx, WithCodec(upperCodec{}))
+	assert.NotNil(t, client)
+
+	codec, ok := client.codecs.lookup("text/plain; charset=utf-8")
+	assert.True(t, ok)
+	assert.Equal(t, upperCodec{}, codec)
+
+	codec, ok = client.codecs.lookup("application/json")
+	assert.True(t, ok)
+	assert.Equal(t, JSONCodec{}, codec)
+}
+
+func TestWithDefaultHeaders(t *testing.T) {
+	ctx := context.Background()
+
+	type item struct {
+		Name string `xml:"name" json:"name"`
+	}
+
+	// The server echoes the body, answering with the accepted type
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, []string{"a", "b"}, r.Header.Values("X-Tags"))
+		assert.Equal(t, []string{r.Header.Get("X-Expect-Source")}, r.Header.Values("X-Source"))
+		assert.Equal(t, r.Header.Get("X-Expect-Accept"), r.Header.Get("Accept"))
+
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.Header.Get("Accept"))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := NewClient(ctx, WithDefaultHeaders(http.Header{
+		"x-tags":       {"a", "b"},
+		"X-Source":     {"client"},
+		"Content-Type": {XMLContentType},
+		"Accept":       {XMLContentType},
+	}))
+	assert.Equal(t, []string{"a", "b"}, client.defaultHeaders.Values("X-Tags"))
+
+	t.Run("replace request defaults", func(t *testing.T) {
+		var out item
+		_, err := NewRequest().
+			SetMethod(http.MethodPost).
+			SetURL(server.URL).
+			SetHeader("X-Expect-Source", "client").
+			SetHeader("X-Expect-Accept", XMLContentType).
+			SetRequestBody(item{Name: "gohans"}).
+			SetWantedResponseBody(&out).
+			Send(ctx, client)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "gohans", out.Name)
+	})
+
+	t.Run("headers set on the request win", func(t *testing.T) {
+		var out item
+		_, err := NewRequest().
+			SetMethod(http.MethodPost).
+			SetURL(server.URL).
+			SetHeader("X-Source", "request").
+			SetHeader("Content-Type", JSONContentType).
+			AddHeader("Accept", JSONContentType).
+			SetHeader("X-Expect-Source", "request").
+			SetHeader("X-Expect-Accept", JSONContentType).
+			SetRequestBody(item{Name: "gohans"}).
+			SetWantedResponseBody(&out).
+			Send(ctx, client)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "gohans", out.Name)
+	})
+}
+
+func TestWithBaseURL(t *testing.T) {
+	ctx := context.Background()
+
+	client := NewClient(ctx, WithBaseURL("https://api.example.com/v1"))
+	assert.NoError(t, client.err)
+	assert.Equal(t, "https://api.example.com/v1/", client.baseURL.String())
+
+	client = NewClient(ctx, WithBaseURL("💀://api.example.com"))
+	assert.Error(t, client.err)
+
+	body, err := NewRequest().SetPath("/users").Send(ctx, client)
+	assert.Nil(t, body)
+	assert.Equal(t, client.err, err)
+}
+
+func TestClient_requestURL(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		base    string
+		url     string
+		path    string
+		params  map[string]string
+		want    string
+		wantErr error
+	}{
+		{name: "url only", url: "http://localhost/users?page=1", want: "http://localhost/users?page=1"},
+		{name: "base and path", base: "https://api.example.com/v1", path: "/users/{id}/orders/{orderID}", params: map[string]string{"id": "42", "orderID": "a/b"}, want: "https://api.example.com/v1/users/42/orders/a%2Fb"},
+		{name: "base with slash and relative path", base: "https://api.example.com/v1/", path: "users", want: "https://api.example.com/v1/users"},
+		{name: "base keeps query", base: "https://api.example.com/?api-version=2", path: "users", want: "https://api.example.com/users?api-version=2"},
+		{name: "colon in first segment", base: "https://api.example.com/v1", path: "users:batchGet", want: "https://api.example.com/v1/users:batchGet"},
+		{name: "base and relative url", base: "https://api.example.com/v1", url: "users?page=2", want: "https://api.example.com/v1/users?page=2"},
+		{name: "base and rooted url", base: "https://api.example.com/v1", url: "/health", want: "https://api.example.com/health"},
+		{name: "rooted path stays below base", base: "https://api.example.com/v1", path: "/health", want: "https://api.example.com/v1/health"},
+		{name: "relative url drops base query", base: "https://api.example.com/v1?api-version=2", url: "users", want: "https://api.example.com/v1/users"},
+		{name: "absolute url overrides base", base: "https://api.example.com/v1", url: "https://other.example.com/users", want: "https://other.example.com/users"},
+		{name: "url and path", url: "https://api.example.com/v2?x=1", path: "/users/{id}", params: map[string]string{"id": "7"}, want: "https://api.example.com/v2/users/7?x=1"},
+		{name: "path traversal", base: "https://api.example.com/v1", path: "/users/{id}", params: map[string]string{"id": ".."}, want: "https://api.example.com/v1/users/%2E%2E"},
+		{name: "missing param", base: "https://api.example.com/v1", path: "/users/{id}", wantErr: MissingPathParamError},
+		{name: "missing url", wantErr: MissingURLError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []RequestOption
+			if tt.base != "" {
+				opts = append(opts, WithBaseURL(tt.base))
+			}
+			client := NewClient(ctx, opts...)
+
+			r := NewRequest().SetURL(tt.url).SetPath(tt.path).SetPathParams(tt.params)
+
+			u, err := client.requestURL(r)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				assert.Equal(t, tt.want, u.String())
+			}
+		})
+	}
+
+	t.Run("base url is not modified", func(t *testing.T) {
+		client := NewClient(ctx, WithBaseURL("https://api.example.com/v1"))
+
+		u, err := client.requestURL(NewRequest())
+		assert.NoError(t, err)
+		u.RawQuery = "a=1"
+
+		assert.Equal(t, "https://api.example.com/v1/", client.baseURL.String())
+	})
+}
+
 func TestSend(t *testing.T) {
 	ctx := context.Background()
 
@@ -143,11 +294,21 @@ func TestSend(t *testing.T) {
 		body, err := r.Send(ctx, client)
 
 		assert.NotNil(t, body)
-		assert.Equal(t, UnexpectedStatusCodeError, err)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
 		assert.Equal(t, `{"error": "error creating response"}`, string(body))
 		assert.Equal(t, "", ok.Status)
 
 		assert.Equal(t, "error creating response", e.Error)
+
+		var httpErr *HTTPError
+		assert.ErrorAs(t, err, &httpErr)
+		assert.Equal(t, http.StatusInternalServerError, httpErr.StatusCode)
+		assert.Equal(t, http.MethodGet, httpErr.Method)
+		assert.Equal(t, server.URL, httpErr.URL)
+		assert.Equal(t, body, httpErr.Body)
+		assert.Equal(t, &e, httpErr.ErrorBody)
+		assert.NotNil(t, httpErr.Header)
+		assert.True(t, httpErr.IsServerError())
 	})
 
 	t.Run("http server failure, map decode", func(t *testing.T) {
@@ -175,7 +336,7 @@ func TestSend(t *testing.T) {
 		body, err := r.Send(ctx, client)
 
 		assert.NotNil(t, body)
-		assert.Equal(t, UnexpectedStatusCodeError, err)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
 		assert.Equal(t, `{"error": "error creating response"}`, string(body))
 		assert.Equal(t, "", ok.Status)
 
@@ -207,9 +368,35 @@ func TestSend(t *testing.T) {
 		body, err := r.Send(ctx, client)
 
 		assert.NotNil(t, body)
-		assert.EqualError(t, err, "invalid character ']' looking for beginning of object key string")
+		assert.ErrorContains(t, err, "invalid character ']' looking for beginning of object key string")
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
 		assert.Equal(t, `{]`, string(body))
 		assert.Equal(t, "", ok.Status)
+
+		var httpErr *HTTPError
+		assert.ErrorAs(t, err, &httpErr)
+		assert.Equal(t, http.StatusInternalServerError, httpErr.StatusCode)
+		assert.Nil(t, httpErr.ErrorBody)
+	})
+
+	t.Run("empty error response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		body, err := NewRequest().
+			SetURL(server.URL+"/users/1?api_key=secret&page=2").
+			Send(ctx, client)
+
+		assert.Empty(t, body)
+
+		var httpErr *HTTPError
+		assert.ErrorAs(t, err, &httpErr)
+		assert.True(t, httpErr.IsNotFound())
+		assert.Nil(t, httpErr.ErrorBody)
+		assert.Equal(t, server.URL+"/users/1?api_key=xxxxx&page=2", httpErr.URL)
+		assert.Equal(t, "unexpected status code 404 (GET "+server.URL+"/users/1?api_key=xxxxx&page=2)", err.Error())
 	})
 
 	t.Run("error decoding success response", func(t *testing.T) {
@@ -242,6 +429,96 @@ func TestSend(t *testing.T) {
 		assert.Equal(t, "", ok.Status)
 	})
 
+	t.Run("xml request and response", func(t *testing.T) {
+		type envelope struct {
+			XMLName xml.Name `xml:"envelope"`
+			Query   string   `xml:"query"`
+			Result  string   `xml:"result"`
+		}
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "text/xml; charset=utf-8", r.Header.Get("Content-Type"))
+
+			var in envelope
+			assert.NoError(t, xml.NewDecoder(r.Body).Decode(&in))
+			assert.Equal(t, "get", in.Query)
+
+			w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`<envelope><result>ok</result></envelope>`))
+		}))
+		defer server.Close()
+
+		var out envelope
+
+		body, err := NewRequest().
+			SetMethod(http.MethodPost).
+			SetURL(server.URL).
+			AddHeader("Content-Type", "text/xml; charset=utf-8").
+			AddHeader("Accept", XMLContentType).
+			SetRequestBody(envelope{Query: "get"}).
+			SetWantedResponseBody(&out).
+			Send(ctx, client)
+
+		assert.Nil(t, err)
+		assert.Equal(t, `<envelope><result>ok</result></envelope>`, string(body))
+		assert.Equal(t, "ok", out.Result)
+	})
+
+	t.Run("xml response without content type", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`<item><key>value</key></item>`))
+		}))
+		defer server.Close()
+
+		var out struct {
+			Key string `xml:"key"`
+		}
+
+		_, err := NewRequest().
+			SetURL(server.URL).
+			AddHeader("Accept", XMLContentType).
+			SetWantedResponseBody(&out).
+			Send(ctx, client)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "value", out.Key)
+	})
+
+	t.Run("error no codec for request body", func(t *testing.T) {
+		r := NewRequest().
+			SetMethod(http.MethodPost).
+			SetURL("http://localhost").
+			AddHeader("Content-Type", "application/octet-stream").
+			SetRequestBody([]byte("raw"))
+
+		body, err := r.Send(ctx, client)
+		assert.Nil(t, body)
+		assert.ErrorIs(t, err, InvalidContentTypeError)
+	})
+
+	t.Run("base url and path params", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/users/a%20b/orders/7", r.URL.EscapedPath())
+			assert.Equal(t, "2", r.URL.Query().Get("page"))
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		client := NewClient(ctx, WithBaseURL(server.URL+"/api"))
+
+		_, err := NewRequest().
+			SetPath("/users/{id}/orders/{orderID}").
+			SetPathParam("id", "a b").
+			SetPathParam("orderID", "7").
+			SetQueryParam("page", "2").
+			Send(ctx, client)
+
+		assert.NoError(t, err)
+	})
+
 	t.Run("error encoding request", func(t *testing.T) {
 		r := NewRequest().
 			SetMethod(http.MethodGet).
@@ -0,0 +1,161 @@
+package gohans
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// Codec encodes request bodies and decodes response bodies for a set of media types
+type Codec interface {
+	// ContentTypes returns the media types handled by the codec, e.g. application/json
+	ContentTypes() []string
+	// Encode writes the encoded form of v to w
+	Encode(w io.Writer, v any) error
+	// Decode reads an encoded value from r and stores it in v
+	Decode(r io.Reader, v any) error
+}
+
+// JSONCodec encodes and decodes application/json bodies
+type JSONCodec struct{}
+
+// ContentTypes returns the media types handled by the JSON codec
+func (JSONCodec) ContentTypes() []string {
+	return []string{JSONContentType}
+}
+
+// Encode encodes v as JSON
+func (JSONCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Decode decodes JSON from r into v
+func (JSONCodec) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// XMLCodec encodes and decodes application/xml and text/xml bodies
+type XMLCodec struct{}
+
+// ContentTypes returns the media types handled by the XML codec
+func (XMLCodec) ContentTypes() []string {
+	return []string{XMLContentType, TextXMLContentType}
+}
+
+// Encode encodes v as XML
+func (XMLCodec) Encode(w io.Writer, v any) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// Decode decodes XML from r into v
+func (XMLCodec) Decode(r io.Reader, v any) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// FormCodec encodes and decodes application/x-www-form-urlencoded bodies
+// It encodes url.Values, map[string]string and structs with `url` tags, and decodes into *url.Values
+type FormCodec struct{}
+
+// ContentTypes returns the media types handled by the form codec
+func (FormCodec) ContentTypes() []string {
+	return []string{FormContentType}
+}
+
+// Encode encodes v as a url encoded form
+func (FormCodec) Encode(w io.Writer, v any) error {
+	var values url.Values
+
+	switch v := v.(type) {
+	case url.Values:
+		values = v
+	case map[string][]string:
+		values = v
+	case map[string]string:
+		values = url.Values{}
+		for k, s := range v {
+			values.Set(k, s)
+		}
+	default:
+		var err error
+		values, err = encodeQueryStruct(v)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, values.Encode())
+
+	return err
+}
+
+// Decode decodes a url encoded form from r into v, which must be a *url.Values
+func (FormCodec) Decode(r io.Reader, v any) error {
+	target, ok := v.(*url.Values)
+	if !ok {
+		return fmt.Errorf("form: cannot decode into %T", v)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	*target, err = url.ParseQuery(string(b))
+
+	return err
+}
+
+// codecRegistry maps lower-cased media types to the codec handling them
+type codecRegistry map[string]Codec
+
+// defaultCodecs returns a registry with the built-in JSON, XML and form codecs
+func defaultCodecs() codecRegistry {
+	cr := codecRegistry{}
+	cr.register(JSONCodec{})
+	cr.register(XMLCodec{})
+	cr.register(FormCodec{})
+
+	return cr
+}
+
+func (cr codecRegistry) register(codec Codec) {
+	for _, ct := range codec.ContentTypes() {
+		cr[strings.ToLower(ct)] = codec
+	}
+}
+
+// lookup returns the codec for a Content-Type header value
+// Parameters such as charset are ignored, and structured syntax suffixes
+// (application/problem+json, application/soap+xml) fall back to the base codec
+func (cr codecRegistry) lookup(contentType string) (Codec, bool) {
+	mt := mediaType(contentType)
+	if mt == "" {
+		return nil, false
+	}
+
+	if codec, ok := cr[mt]; ok {
+		return codec, true
+	}
+
+	if i := strings.LastIndexByte(mt, '+'); i >= 0 {
+		codec, ok := cr["application/"+mt[i+1:]]
+
+		return codec, ok
+	}
+
+	return nil, false
+}
+
+// mediaType returns the lower-cased media type of a Content-Type header value without its parameters
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt, _, _ = strings.Cut(contentType, ";")
+	}
+
+	return strings.ToLower(strings.TrimSpace(mt))
+}
@@ -0,0 +1,137 @@
+package gohans
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type upperCodec struct{}
+
+func (upperCodec) ContentTypes() []string { return []string{"text/plain"} }
+
+func (upperCodec) Encode(w io.Writer, v any) error {
+	_, err := io.WriteString(w, strings.ToUpper(v.(string)))
+	return err
+}
+
+func (upperCodec) Decode(r io.Reader, v any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	*(v.(*string)) = strings.ToLower(string(b))
+	return nil
+}
+
+func TestJSONCodec(t *testing.T) {
+	var buf bytes.Buffer
+	codec := JSONCodec{}
+
+	assert.Equal(t, []string{"application/json"}, codec.ContentTypes())
+	assert.NoError(t, codec.Encode(&buf, map[string]string{"key": "value"}))
+	assert.Equal(t, "{\"key\":\"value\"}\n", buf.String())
+
+	var out map[string]string
+	assert.NoError(t, codec.Decode(&buf, &out))
+	assert.Equal(t, "value", out["key"])
+}
+
+func TestXMLCodec(t *testing.T) {
+	type item struct {
+		Key string `xml:"key"`
+	}
+
+	var buf bytes.Buffer
+	codec := XMLCodec{}
+
+	assert.Equal(t, []string{"application/xml", "text/xml"}, codec.ContentTypes())
+	assert.NoError(t, codec.Encode(&buf, item{Key: "value"}))
+	assert.Equal(t, "<item><key>value</key></item>", buf.String())
+
+	var out item
+	assert.NoError(t, codec.Decode(&buf, &out))
+	assert.Equal(t, "value", out.Key)
+}
+
+func TestFormCodec(t *testing.T) {
+	codec := FormCodec{}
+	assert.Equal(t, []string{"application/x-www-form-urlencoded"}, codec.ContentTypes())
+
+	tests := []struct {
+		name string
+		in   any
+		want string
+	}{
+		{"url values", url.Values{"b": {"2"}, "a": {"1", "x y"}}, "a=1&a=x+y&b=2"},
+		{"map of slices", map[string][]string{"a": {"1"}}, "a=1"},
+		{"map", map[string]string{"a": "1", "b": "&"}, "a=1&b=%26"},
+		{"struct", struct {
+			Name string `url:"name"`
+			Skip string `url:"skip,omitempty"`
+		}{Name: "hans"}, "name=hans"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, codec.Encode(&buf, tt.in))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+
+	t.Run("encode error", func(t *testing.T) {
+		assert.Error(t, codec.Encode(io.Discard, 42))
+	})
+
+	t.Run("decode", func(t *testing.T) {
+		var out url.Values
+		assert.NoError(t, codec.Decode(strings.NewReader("a=1&a=2&b=x+y"), &out))
+		assert.Equal(t, url.Values{"a": {"1", "2"}, "b": {"x y"}}, out)
+
+		var m map[string]string
+		assert.EqualError(t, codec.Decode(strings.NewReader("a=1"), &m), "form: cannot decode into *map[string]string")
+	})
+}
+
+func Test_codecRegistry_lookup(t *testing.T) {
+	codecs := defaultCodecs()
+	codecs.register(upperCodec{})
+
+	tests := []struct {
+		contentType string
+		want        Codec
+	}{
+		{"application/json", JSONCodec{}},
+		{"Application/JSON; charset=utf-8", JSONCodec{}},
+		{"application/problem+json", JSONCodec{}},
+		{"application/xml", XMLCodec{}},
+		{"text/xml; charset=ISO-8859-1", XMLCodec{}},
+		{"application/soap+xml; charset=utf-8", XMLCodec{}},
+		{"text/plain", upperCodec{}},
+		{"application/x-www-form-urlencoded", FormCodec{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			codec, ok := codecs.lookup(tt.contentType)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, codec)
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		_, ok := codecs.lookup("application/octet-stream")
+		assert.False(t, ok)
+
+		_, ok = codecs.lookup("")
+		assert.False(t, ok)
+
+		_, ok = codecs.lookup("application/vnd.custom+yaml")
+		assert.False(t, ok)
+	})
+}
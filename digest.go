@@ -0,0 +1,243 @@
+package gohans
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DigestAuth authenticates requests with HTTP Digest authentication, as defined by RFC 7616
+// The first request is sent without credentials to get the server challenge, later requests reuse its nonce
+// Supports the MD5 and SHA-256 algorithms, their -sess variants, and qop=auth
+type DigestAuth struct {
+	username string
+	password string
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	count     int
+}
+
+// digestChallenge holds the parameters of a WWW-Authenticate: Digest header
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+}
+
+// NewDigestAuth returns an authenticator using HTTP Digest authentication
+func NewDigestAuth(username, password string) *DigestAuth {
+	return &DigestAuth{username: username, password: password}
+}
+
+// Authenticate answers the last challenge of the server, the request is sent as is before the first one
+func (a *DigestAuth) Authenticate(req *http.Request) error {
+	a.mu.Lock()
+	ch := a.challenge
+	a.count++
+	count := a.count
+	a.mu.Unlock()
+
+	if ch == nil {
+		return nil
+	}
+
+	cnonce, err := newCnonce()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", ch.authorization(a.username, a.password, req.Method, req.URL.RequestURI(), cnonce, count))
+
+	return nil
+}
+
+// Challenge records the Digest challenge of a 401 response
+// It reports false when the server has none this client supports, or rejected an answer to the same nonce
+func (a *DigestAuth) Challenge(resp *http.Response) bool {
+	ch := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if ch == nil {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Credentials answering the same nonce were rejected, unless the server reports the nonce as stale
+	if !ch.stale && resp.Request != nil {
+		sent := parseAuthParams(strings.TrimPrefix(resp.Request.Header.Get("Authorization"), "Digest "))
+		if sent["nonce"] == ch.nonce {
+			return false
+		}
+	}
+
+	// Concurrent requests get the same challenge, the count only restarts with a new nonce
+	if a.challenge == nil || a.challenge.nonce != ch.nonce {
+		a.count = 0
+	}
+
+	a.challenge = ch
+
+	return true
+}
+
+// parseDigestChallenge returns the supported Digest challenge of the header values, preferring SHA-256 to MD5
+func parseDigestChallenge(values []string) *digestChallenge {
+	var best *digestChallenge
+	for _, v := range values {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+
+		p := parseAuthParams(params)
+		ch := &digestChallenge{
+			realm:     p["realm"],
+			nonce:     p["nonce"],
+			opaque:    p["opaque"],
+			algorithm: strings.ToUpper(p["algorithm"]),
+			stale:     strings.EqualFold(p["stale"], "true"),
+		}
+
+		if ch.algorithm == "" {
+			ch.algorithm = "MD5"
+		}
+
+		if digestHash(ch.algorithm) == nil || ch.nonce == "" {
+			continue
+		}
+
+		// Without qop the legacy RFC 2069 response is used, auth-int is not supported
+		if qop, ok := p["qop"]; ok {
+			for _, q := range strings.Split(qop, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					ch.qop = "auth"
+				}
+			}
+
+			if ch.qop == "" {
+				continue
+			}
+		}
+
+		if best == nil || strings.HasPrefix(ch.algorithm, "SHA-256") && !strings.HasPrefix(best.algorithm, "SHA-256") {
+			best = ch
+		}
+	}
+
+	return best
+}
+
+// digestHash returns the hash function of a Digest algorithm, nil when it is not supported
+func digestHash(algorithm string) func() hash.Hash {
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	}
+
+	return nil
+}
+
+// authorization returns the Authorization header answering the challenge
+func (ch *digestChallenge) authorization(username, password, method, uri, cnonce string, count int) string {
+	nc := fmt.Sprintf("%08x", count)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		escapeQuotes(username), escapeQuotes(ch.realm), escapeQuotes(ch.nonce), escapeQuotes(uri), ch.algorithm,
+		ch.response(username, password, method, uri, cnonce, nc))
+
+	if ch.opaque != "" {
+		fmt.Fprintf(&b, `, opaque="%s"`, escapeQuotes(ch.opaque))
+	}
+
+	if ch.qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce="%s"`, ch.qop, nc, cnonce)
+	}
+
+	return b.String()
+}
+
+// response computes the request digest of RFC 7616 section 3.4.1
+func (ch *digestChallenge) response(username, password, method, uri, cnonce, nc string) string {
+	h := func(s string) string {
+		d := digestHash(ch.algorithm)()
+		d.Write([]byte(s))
+
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	ha1 := h(username + ":" + ch.realm + ":" + password)
+	if strings.HasSuffix(ch.algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + ch.nonce + ":" + cnonce)
+	}
+
+	ha2 := h(method + ":" + uri)
+
+	if ch.qop == "" {
+		return h(ha1 + ":" + ch.nonce + ":" + ha2)
+	}
+
+	return h(ha1 + ":" + ch.nonce + ":" + nc + ":" + cnonce + ":" + ch.qop + ":" + ha2)
+}
+
+func newCnonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// parseAuthParams parses comma separated auth parameters, with optionally quoted values
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", ") {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " ")
+
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+
+				value.WriteByte(rest[i])
+			}
+
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+
+			value.WriteString(strings.TrimSpace(rest[:end]))
+			s = rest[end:]
+		}
+
+		params[key] = value.String()
+	}
+
+	return params
+}
@@ -0,0 +1,192 @@
+package gohans
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_digestChallenge_response(t *testing.T) {
+	// RFC 7616 section 3.9.1
+	ch := &digestChallenge{
+		realm: "http-auth@example.org",
+		nonce: "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		qop:   "auth",
+	}
+	cnonce := "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+
+	ch.algorithm = "MD5"
+	assert.Equal(t, "8ca523f5e9506fed4657c9700eebdbec",
+		ch.response("Mufasa", "Circle of Life", http.MethodGet, "/dir/index.html", cnonce, "00000001"))
+
+	ch.algorithm = "SHA-256"
+	assert.Equal(t, "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+		ch.response("Mufasa", "Circle of Life", http.MethodGet, "/dir/index.html", cnonce, "00000001"))
+}
+
+func Test_parseDigestChallenge(t *testing.T) {
+	t.Run("prefers SHA-256", func(t *testing.T) {
+		ch := parseDigestChallenge([]string{
+			`Basic realm="api"`,
+			`Digest realm="api", qop="auth, auth-int", algorithm=MD5, nonce="n1", opaque="o"`,
+			`Digest realm="api", qop="auth, auth-int", algorithm=SHA-256, nonce="n2", opaque="o"`,
+		})
+
+		assert.Equal(t, &digestChallenge{realm: "api", nonce: "n2", opaque: "o", algorithm: "SHA-256", qop: "auth"}, ch)
+	})
+
+	t.Run("defaults to MD5 without qop", func(t *testing.T) {
+		ch := parseDigestChallenge([]string{`Digest realm="a \"quoted\" realm", nonce="n", stale=TRUE`})
+
+		assert.Equal(t, &digestChallenge{realm: `a "quoted" realm`, nonce: "n", algorithm: "MD5", stale: true}, ch)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		assert.Nil(t, parseDigestChallenge([]string{`Digest realm="api", nonce="n", algorithm=SHA-512-256`}))
+		assert.Nil(t, parseDigestChallenge([]string{`Digest realm="api", nonce="n", qop="auth-int"`}))
+		assert.Nil(t, parseDigestChallenge([]string{`Bearer realm="api"`}))
+	})
+}
+
+func Test_parseAuthParams(t *testing.T) {
+	assert.Equal(t, map[string]string{"realm": "a, b", "nonce": "x", "qop": "auth", "escaped": `\`},
+		parseAuthParams(`realm="a, b",nonce=x ,  QOP="auth", escaped="\\"`))
+	assert.Empty(t, parseAuthParams(""))
+}
+
+// digestServer accepts SHA-256 Digest credentials of user:pass, reporting its nonce as stale every third answer
+func digestServer(t *testing.T) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var nonces []string
+	var counts []string
+	served := 0
+
+	h := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		challenge := func(stale bool) {
+			nonce := fmt.Sprintf("nonce-%d", len(nonces))
+			nonces = append(nonces, nonce)
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="test", qop="auth", algorithm=SHA-256, nonce="%s", opaque="op", stale=%t`, nonce, stale))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			challenge(false)
+			return
+		}
+
+		p := parseAuthParams(auth[len("Digest "):])
+		ha1 := h("user:test:pass")
+		ha2 := h(r.Method + ":" + r.URL.RequestURI())
+		expected := h(ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":auth:" + ha2)
+
+		assert.Equal(t, r.URL.RequestURI(), p["uri"])
+		assert.Equal(t, "op", p["opaque"])
+
+		if p["response"] != expected {
+			challenge(false)
+			return
+		}
+
+		served++
+		counts = append(counts, p["nc"])
+
+		// Every third answer gets a stale nonce challenge
+		if p["nonce"] != nonces[len(nonces)-1] || served%3 == 0 {
+			challenge(true)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server, &counts
+}
+
+func TestDigestAuth(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("answers challenges", func(t *testing.T) {
+		server, counts := digestServer(t)
+		client := NewClient(ctx, WithAuthenticator(NewDigestAuth("user", "pass")))
+
+		for range 4 {
+			_, err := NewRequest().SetURL(server.URL+"/items?page=2").Send(ctx, client)
+			assert.NoError(t, err)
+		}
+
+		// The nonce is reused with an increasing count until the server reports it as stale
+		assert.Equal(t, []string{"00000001", "00000002", "00000003", "00000001", "00000002"}, *counts)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		server, counts := digestServer(t)
+		client := NewClient(ctx, WithAuthenticator(NewDigestAuth("user", "wrong")))
+
+		r := NewRequest().SetURL(server.URL)
+		_, err := r.Send(ctx, client)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+		assert.Equal(t, http.StatusUnauthorized, r.GetStatusCode())
+		assert.Empty(t, *counts)
+	})
+
+	t.Run("rejected answer to the same nonce", func(t *testing.T) {
+		a := NewDigestAuth("user", "wrong")
+		challenge := http.Header{"Www-Authenticate": {`Digest realm="test", qop="auth", nonce="n"`}}
+
+		assert.True(t, a.Challenge(&http.Response{Header: challenge, Request: &http.Request{Header: http.Header{}}}))
+
+		sent := &http.Request{Header: http.Header{"Authorization": {`Digest username="user", nonce="n"`}}}
+		assert.False(t, a.Challenge(&http.Response{Header: challenge, Request: sent}))
+
+		challenge.Set("Www-Authenticate", `Digest realm="test", qop="auth", nonce="n", stale=true`)
+		assert.True(t, a.Challenge(&http.Response{Header: challenge, Request: sent}))
+	})
+	t.Run("concurrent challenges with the same nonce", func(t *testing.T) {
+		a := NewDigestAuth("user", "pass")
+		challenge := http.Header{"Www-Authenticate": {`Digest realm="test", qop="auth", nonce="n"`}}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		counts := map[string]int{}
+
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				assert.True(t, a.Challenge(&http.Response{Header: challenge, Request: &http.Request{Header: http.Header{}}}))
+
+				req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+				assert.NoError(t, a.Authenticate(req))
+
+				mu.Lock()
+				counts[parseAuthParams(req.Header.Get("Authorization")[len("Digest "):])["nc"]]++
+				mu.Unlock()
+			}()
+		}
+
+		wg.Wait()
+
+		// Every answer to the nonce uses its own count
+		assert.Len(t, counts, 10)
+	})
+}
@@ -0,0 +1,494 @@
+package gohans
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	ChecksumMismatchError   = errors.New("checksum mismatch")
+	InvalidChecksumError    = errors.New("invalid checksum")
+	ResumeNotSupportedError = errors.New("download cannot be resumed")
+)
+
+// ProgressFunc reports the number of body bytes written so far and the total size, -1 if unknown
+// Resumed downloads count the bytes already present in the file
+type ProgressFunc func(written, total int64)
+
+// download streams a success response body to a writer or a file instead of buffering it in memory
+type download struct {
+	writer   io.Writer
+	path     string
+	progress ProgressFunc
+	// checksum is the expected hex or base64 SHA-256 digest of the body
+	checksum string
+	// checksumHeader names a response header holding the expected digest
+	checksumHeader string
+	// resumes is the number of Range requests sent to resume an interrupted body
+	resumes int
+
+	// offset is the size of the partial file the last attempt resumed from
+	offset int64
+	// size is the full size of the body, -1 if unknown
+	size int64
+	// written is the number of bytes written by the last attempt, including offset
+	written int64
+}
+
+// streaming reports whether the response body is streamed to a writer or a file
+func (d *download) streaming() bool {
+	return d != nil && (d.writer != nil || d.path != "")
+}
+
+// restartable reports whether the request can be sent again after a failed attempt
+// A file is rewritten from the start or resumed, but bytes written to a writer cannot be taken back
+func (d *download) restartable() bool {
+	return d == nil || d.path != "" || d.written == 0
+}
+
+// prepare asks for the rest of a partial file left by an earlier download when resuming is enabled
+// Files without a resume state are of unknown origin and downloaded again in full
+func (d *download) prepare(req *http.Request) {
+	d.offset = 0
+	d.written = 0
+	d.size = -1
+
+	if d.path == "" || d.resumes <= 0 {
+		return
+	}
+
+	state, ok := readResumeState(d.path)
+	if !ok {
+		return
+	}
+
+	fi, err := os.Stat(d.path)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() == 0 || fi.Size() > state.Size {
+		return
+	}
+
+	d.offset = fi.Size()
+	d.size = state.Size
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.offset))
+	req.Header.Set("If-Range", state.Validator)
+}
+
+// mismatched reports whether a ranged response is for a body of another size than the one the partial file belongs to
+func (d *download) mismatched(resp *http.Response) bool {
+	if d.offset == 0 || resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		return false
+	}
+
+	_, size, ok := contentRange(resp.Header.Get("Content-Range"))
+
+	return !ok || size != d.size
+}
+
+// restart returns the request for the whole body, replacing the partial file
+func (d *download) restart(req *http.Request) (*http.Request, error) {
+	d.offset = 0
+	d.size = -1
+
+	next, err := cloneRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	next.Header.Del("Range")
+	next.Header.Del("If-Range")
+
+	return next, nil
+}
+
+// accepts reports whether the response is streamed rather than handled as an unexpected status code
+// Besides the expected status, a ranged request accepts the rest of the file, or a 416 for an already complete file
+func (d *download) accepts(resp *http.Response, expected int) bool {
+	if resp.StatusCode == expected {
+		return true
+	}
+
+	if d.offset == 0 {
+		return false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, _, ok := contentRange(resp.Header.Get("Content-Range"))
+
+		return ok && start == d.offset
+	case http.StatusRequestedRangeNotSatisfiable:
+		_, size, ok := contentRange(resp.Header.Get("Content-Range"))
+
+		return ok && size == d.offset
+	}
+
+	return false
+}
+
+// download streams the response body, resuming it with Range requests when it is interrupted
+func (c *Client) download(r *Request, req *http.Request, resp *http.Response) (err error) {
+	d := r.download
+
+	expected, err := d.expectedChecksum(resp.Header)
+	if err != nil {
+		return err
+	}
+
+	// A server ignoring the Range header, or a resource changed since the partial file, sends the whole body again
+	if resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		_, d.size, _ = contentRange(resp.Header.Get("Content-Range"))
+	} else {
+		d.offset = 0
+		d.size = -1
+		if resp.ContentLength >= 0 && !resp.Uncompressed {
+			d.size = resp.ContentLength
+		}
+	}
+
+	h := sha256.New()
+
+	w, closeWriter, err := d.open(h, expected != nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, closeWriter())
+	}()
+
+	if d.path != "" {
+		if err := d.saveResumeState(resp.Header); err != nil {
+			return err
+		}
+
+		// A complete file needs no resume state, and a corrupt one is removed with it
+		defer func() {
+			if err == nil || errors.Is(err, ChecksumMismatchError) {
+				err = errors.Join(err, removeResumeState(d.path))
+			}
+		}()
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = d.offset + resp.ContentLength
+	}
+
+	pw := &progressWriter{w: io.MultiWriter(w, h), written: d.offset, total: total, fn: d.progress}
+	defer func() {
+		d.written = pw.written
+	}()
+
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		if err := c.copyBody(r, req, resp, pw); err != nil {
+			return err
+		}
+	}
+
+	if expected == nil {
+		return nil
+	}
+
+	if sum := h.Sum(nil); !bytes.Equal(sum, expected) {
+		if d.path != "" {
+			// The file is corrupt, a partial file would be resumed on the next attempt
+			_ = closeWriter()
+			_ = os.Remove(d.path)
+		}
+
+		return fmt.Errorf("%w: expected %x, got %x", ChecksumMismatchError, expected, sum)
+	}
+
+	return nil
+}
+
+// copyBody copies the body to w, sending a Range request for the rest of the body after each interruption
+func (c *Client) copyBody(r *Request, req *http.Request, resp *http.Response, w *progressWriter) error {
+	body := resp.Body
+
+	for resumes := 0; ; resumes++ {
+		_, err := io.Copy(w, body)
+
+		// The interrupted body is closed before resuming, releasing its connection and bulkhead slot
+		body.Close()
+
+		if err == nil {
+			return nil
+		}
+
+		// Only an interrupted read is resumed, a failing writer would fail again
+		if w.err != nil || resumes >= r.download.resumes || req.Context().Err() != nil || !rangeable(resp) {
+			return err
+		}
+
+		c.logger.Warn("resuming interrupted download", "offset", w.written, "error", err)
+
+		next, rerr := c.resume(r, req, resp, w.written)
+		if rerr != nil {
+			return errors.Join(err, rerr)
+		}
+
+		body = next.Body
+	}
+}
+
+// resume requests the rest of the body from offset
+// If-Range makes sure the rest belongs to the same version of the resource
+func (c *Client) resume(r *Request, req *http.Request, resp *http.Response, offset int64) (*http.Response, error) {
+	next, err := cloneRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	next.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	if v := validator(resp.Header); v != "" {
+		next.Header.Set("If-Range", v)
+	}
+
+	res, err := c.roundTrip(r, next)
+	if err != nil {
+		return nil, err
+	}
+
+	start, size, ok := contentRange(res.Header.Get("Content-Range"))
+	if res.StatusCode != http.StatusPartialContent || !ok || start != offset || r.download.size >= 0 && size != r.download.size {
+		res.Body.Close()
+
+		return nil, fmt.Errorf("%w: status code %d", ResumeNotSupportedError, res.StatusCode)
+	}
+
+	return res, nil
+}
+
+// cloneRequest returns a copy of the request with a new body
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		next.Body = body
+	}
+
+	return next, nil
+}
+
+// validator returns the strong ETag or the Last-Modified date of a response, for If-Range
+func validator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return header.Get("Last-Modified")
+}
+
+// resumeState is saved next to a DownloadTo file while it is written,
+// so that only a partial file of the same version of the resource is resumed
+type resumeState struct {
+	Validator string `json:"validator"`
+	Size      int64  `json:"size"`
+}
+
+func resumeStatePath(path string) string {
+	return path + ".resume"
+}
+
+func readResumeState(path string) (resumeState, bool) {
+	var state resumeState
+
+	b, err := os.ReadFile(resumeStatePath(path))
+	if err != nil || json.Unmarshal(b, &state) != nil {
+		return state, false
+	}
+
+	return state, state.Validator != "" && state.Size > 0
+}
+
+// saveResumeState records the version of the resource the file belongs to
+// Without resume attempts, a validator or a known size the file cannot be resumed, and any previous state is removed
+func (d *download) saveResumeState(header http.Header) error {
+	v := validator(header)
+	if d.resumes <= 0 || v == "" || d.size <= 0 {
+		return removeResumeState(d.path)
+	}
+
+	b, err := json.Marshal(resumeState{Validator: v, Size: d.size})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(resumeStatePath(d.path), b, 0o644)
+}
+
+func removeResumeState(path string) error {
+	if err := os.Remove(resumeStatePath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// open returns the writer of the body and a function closing it
+// A resumed file is appended to, and its existing content is hashed when a checksum is verified
+func (d *download) open(h hash.Hash, verify bool) (io.Writer, func() error, error) {
+	if d.path == "" {
+		return d.writer, func() error { return nil }, nil
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if d.offset > 0 {
+		flag = os.O_RDWR | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(d.path, flag, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if d.offset > 0 && verify {
+		if _, err := io.Copy(h, io.NewSectionReader(f, 0, d.offset)); err != nil {
+			f.Close()
+
+			return nil, nil, err
+		}
+	}
+
+	var closed bool
+	closeFile := func() error {
+		if closed {
+			return nil
+		}
+
+		closed = true
+
+		return f.Close()
+	}
+
+	return f, closeFile, nil
+}
+
+// expectedChecksum returns the digest set on the request, or sent in the checksum header
+func (d *download) expectedChecksum(header http.Header) ([]byte, error) {
+	digest := d.checksum
+	if digest == "" && d.checksumHeader != "" {
+		digest = header.Get(d.checksumHeader)
+		if digest == "" {
+			return nil, fmt.Errorf("%w: missing %s header", InvalidChecksumError, d.checksumHeader)
+		}
+	}
+
+	if digest == "" {
+		return nil, nil
+	}
+
+	return parseChecksum(digest)
+}
+
+// parseChecksum decodes a hex or base64 SHA-256 digest
+// The sha-256= prefix and colons of Digest and Content-Digest header values are accepted
+func parseChecksum(digest string) ([]byte, error) {
+	s := strings.TrimSpace(digest)
+	if prefix, rest, ok := strings.Cut(s, "="); ok && strings.EqualFold(prefix, "sha-256") {
+		s = rest
+	}
+
+	s = strings.Trim(s, ":")
+
+	if len(s) == hex.EncodedLen(sha256.Size) {
+		if b, err := hex.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("%w: %q", InvalidChecksumError, digest)
+	}
+
+	return b, nil
+}
+
+// rangeable reports whether the server accepts Range requests for the response
+// Bodies decompressed by the transport cannot be resumed, their offsets do not match the sent bytes
+func rangeable(resp *http.Response) bool {
+	if resp.Uncompressed {
+		return false
+	}
+
+	return resp.StatusCode == http.StatusPartialContent || strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes")
+}
+
+// contentRange parses a Content-Range header value, e.g. bytes 100-199/200 or bytes */200
+// The start is -1 for an unsatisfied range and the size is -1 when unknown
+func contentRange(value string) (start, size int64, ok bool) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+
+	rng, total, found := strings.Cut(rest, "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	size = -1
+	if total != "*" {
+		n, err := strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+
+		size = n
+	}
+
+	if rng == "*" {
+		return -1, size, true
+	}
+
+	first, _, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return start, size, true
+}
+
+// progressWriter counts written bytes and reports them to a ProgressFunc
+type progressWriter struct {
+	w       io.Writer
+	written int64
+	total   int64
+	fn      ProgressFunc
+	// err records a write error, to tell it apart from a read error of the body
+	err error
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.err = err
+
+	if p.fn != nil && n > 0 {
+		p.fn(p.written, p.total)
+	}
+
+	return n, err
+}
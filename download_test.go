@@ -0,0 +1,387 @@
+package gohans
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_contentRange(t *testing.T) {
+	tests := []struct {
+		value string
+		start int64
+		size  int64
+		ok    bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 0-99/*", 0, -1, true},
+		{"bytes */200", -1, 200, true},
+		{"bytes x-99/200", 0, 0, false},
+		{"bytes 0-99/x", 0, 0, false},
+		{"bytes 0-99", 0, 0, false},
+		{"items 0-99/200", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			start, size, ok := contentRange(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.start, start)
+			assert.Equal(t, tt.size, size)
+		})
+	}
+}
+
+func Test_parseChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("data"))
+	b64 := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name   string
+		digest string
+		err    error
+	}{
+		{"hex", hex.EncodeToString(sum[:]), nil},
+		{"base64", b64, nil},
+		{"digest header", "SHA-256=" + b64, nil},
+		{"content digest header", "sha-256=:" + b64 + ":", nil},
+		{"short", "abcd", InvalidChecksumError},
+		{"garbage", "not a digest!", InvalidChecksumError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := parseChecksum(tt.digest)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, sum[:], b)
+		})
+	}
+}
+
+// rangeServer serves content with Range support
+// When interrupt is set, requests without a Range header are aborted half way through the body
+func rangeServer(content []byte, interrupt bool, calls *atomic.Int32) *httptest.Server {
+	sum := sha256.Sum256(content)
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-Checksum-Sha256", hex.EncodeToString(sum[:]))
+
+		if interrupt && r.Header.Get("Range") == "" {
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "", modified, bytes.NewReader(content))
+	}))
+}
+
+func TestRequest_Download(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	t.Run("response writer with progress", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, false, &calls)
+		defer server.Close()
+
+		var buf bytes.Buffer
+		var written, total int64
+
+		res, err := NewRequest().
+			SetURL(server.URL).
+			SetResponseWriter(&buf).
+			SetProgressFunc(func(w, t int64) { written, total = w, t }).
+			SetChecksumHeader("X-Checksum-Sha256").
+			Do(ctx, client)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Empty(t, res.Body)
+		assert.Equal(t, content, buf.Bytes())
+		assert.Equal(t, int64(len(content)), written)
+		assert.Equal(t, int64(len(content)), total)
+	})
+
+	t.Run("error response is not streamed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", JSONContentType)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "missing"}`))
+		}))
+		defer server.Close()
+
+		var buf bytes.Buffer
+		errBody := &Error{}
+
+		_, err := NewRequest().SetURL(server.URL).SetResponseWriter(&buf).SetErrorResponseBody(errBody).Do(ctx, client)
+
+		var httpErr *HTTPError
+		assert.ErrorAs(t, err, &httpErr)
+		assert.True(t, httpErr.IsNotFound())
+		assert.Equal(t, "missing", errBody.Error)
+		assert.Zero(t, buf.Len())
+	})
+
+	t.Run("download to file", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, false, &calls)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "data.bin")
+		sum := sha256.Sum256(content)
+
+		_, err := NewRequest().SetURL(server.URL).DownloadTo(path).SetChecksum(hex.EncodeToString(sum[:])).Do(ctx, client)
+		assert.NoError(t, err)
+
+		b, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, content, b)
+	})
+
+	t.Run("checksum mismatch removes file", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, false, &calls)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "data.bin")
+		sum := sha256.Sum256([]byte("other"))
+
+		_, err := NewRequest().SetURL(server.URL).DownloadTo(path).SetChecksum(hex.EncodeToString(sum[:])).Do(ctx, client)
+		assert.ErrorIs(t, err, ChecksumMismatchError)
+
+		_, err = os.Stat(path)
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+
+	t.Run("missing checksum header", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, false, &calls)
+		defer server.Close()
+
+		var buf bytes.Buffer
+
+		_, err := NewRequest().SetURL(server.URL).SetResponseWriter(&buf).SetChecksumHeader("Content-Digest").Do(ctx, client)
+		assert.ErrorIs(t, err, InvalidChecksumError)
+	})
+
+	t.Run("resume interrupted body", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, true, &calls)
+		defer server.Close()
+
+		var buf bytes.Buffer
+
+		_, err := NewRequest().
+			SetURL(server.URL).
+			SetResponseWriter(&buf).
+			SetResumeAttempts(1).
+			SetChecksumHeader("X-Checksum-Sha256").
+			Do(ctx, client)
+
+		assert.NoError(t, err)
+		assert.Equal(t, content, buf.Bytes())
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("interrupted body without resume", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, true, &calls)
+		defer server.Close()
+
+		var buf bytes.Buffer
+
+		_, err := NewRequest().
+			SetURL(server.URL).
+			SetResponseWriter(&buf).
+			SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryOnError: func(error) bool { return true }}).
+			Do(ctx, client)
+
+		// Bytes already written to the writer cannot be taken back, so the request is not retried
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, content[:len(content)/2], buf.Bytes())
+	})
+
+	t.Run("resume partial file", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, false, &calls)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "data.bin")
+		assert.NoError(t, os.WriteFile(path, content[:1000], 0o644))
+		writeResumeState(t, path, `"v1"`, int64(len(content)))
+
+		var written, total int64
+
+		res, err := NewRequest().
+			SetURL(server.URL).
+			DownloadTo(path).
+			SetResumeAttempts(1).
+			SetProgressFunc(func(w, t int64) { written, total = w, t }).
+			SetChecksumHeader("X-Checksum-Sha256").
+			Do(ctx, client)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+		assert.Equal(t, int64(len(content)), written)
+		assert.Equal(t, int64(len(content)), total)
+
+		b, _ := os.ReadFile(path)
+		assert.Equal(t, content, b)
+
+		// The resume state is removed once the file is complete
+		_, err = os.Stat(resumeStatePath(path))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("complete file", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, false, &calls)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "data.bin")
+		assert.NoError(t, os.WriteFile(path, content, 0o644))
+		writeResumeState(t, path, `"v1"`, int64(len(content)))
+
+		res, err := NewRequest().
+			SetURL(server.URL).
+			DownloadTo(path).
+			SetResumeAttempts(1).
+			SetChecksumHeader("X-Checksum-Sha256").
+			Do(ctx, client)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.StatusCode)
+
+		b, _ := os.ReadFile(path)
+		assert.Equal(t, content, b)
+	})
+
+	t.Run("existing file without resume state", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, false, &calls)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "data.bin")
+		assert.NoError(t, os.WriteFile(path, []byte("old version"), 0o644))
+
+		res, err := NewRequest().SetURL(server.URL).DownloadTo(path).SetResumeAttempts(1).Do(ctx, client)
+
+		// A file this client did not write is replaced rather than appended to
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		b, _ := os.ReadFile(path)
+		assert.Equal(t, content, b)
+	})
+
+	t.Run("partial file of a changed resource", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, false, &calls)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "data.bin")
+		assert.NoError(t, os.WriteFile(path, []byte("old version"), 0o644))
+		writeResumeState(t, path, `"v0"`, int64(len(content)))
+
+		res, err := NewRequest().SetURL(server.URL).DownloadTo(path).SetResumeAttempts(1).Do(ctx, client)
+
+		// If-Range gets the whole body of the new version
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int32(1), calls.Load())
+
+		b, _ := os.ReadFile(path)
+		assert.Equal(t, content, b)
+	})
+
+	t.Run("partial file of another size", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, false, &calls)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "data.bin")
+		assert.NoError(t, os.WriteFile(path, content[:1000], 0o644))
+		writeResumeState(t, path, `"v1"`, int64(len(content))+10)
+
+		res, err := NewRequest().SetURL(server.URL).DownloadTo(path).SetResumeAttempts(1).Do(ctx, client)
+
+		// The range of a body of another size does not belong to the partial file, the whole body is downloaded again
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int32(2), calls.Load())
+
+		b, _ := os.ReadFile(path)
+		assert.Equal(t, content, b)
+	})
+
+	t.Run("failed download keeps resume state", func(t *testing.T) {
+		var calls atomic.Int32
+		server := rangeServer(content, true, &calls)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "data.bin")
+
+		offline := NewClient(ctx, WithMiddleware(func(next RoundTripFunc) RoundTripFunc {
+			return func(r *Request, req *http.Request) (*http.Response, error) {
+				if req.Header.Get("Range") != "" {
+					return nil, errors.New("offline")
+				}
+
+				return next(r, req)
+			}
+		}))
+
+		_, err := NewRequest().SetURL(server.URL).DownloadTo(path).SetResumeAttempts(1).Do(ctx, offline)
+		assert.Error(t, err)
+
+		state, ok := readResumeState(path)
+		assert.True(t, ok)
+		assert.Equal(t, resumeState{Validator: `"v1"`, Size: int64(len(content))}, state)
+
+		// The next download resumes the partial file
+		_, err = NewRequest().SetURL(server.URL).DownloadTo(path).SetResumeAttempts(1).Do(ctx, client)
+		assert.NoError(t, err)
+
+		b, _ := os.ReadFile(path)
+		assert.Equal(t, content, b)
+	})
+}
+
+// writeResumeState records the resume state of a partial file, as an interrupted download does
+func writeResumeState(t *testing.T, path, validator string, size int64) {
+	b, err := json.Marshal(resumeState{Validator: validator, Size: size})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(resumeStatePath(path), b, 0o644))
+}
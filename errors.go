@@ -0,0 +1,78 @@
+package gohans
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// sensitiveQueryParams are query parameters whose values are redacted from error messages
+var sensitiveQueryParams = []string{
+	"access_token", "api_key", "apikey", "client_secret", "key", "password", "secret", "signature", "token",
+}
+
+// HTTPError is returned when a response does not have the expected status code
+// It wraps UnexpectedStatusCodeError, so errors.Is(err, UnexpectedStatusCodeError) keeps working
+type HTTPError struct {
+	Method string
+	// URL is the request URL with credentials and sensitive query values redacted
+	URL        string
+	StatusCode int
+	Header     http.Header
+	// Body is the raw response body
+	Body []byte
+	// ErrorBody is the decoded error response, nil if the body was empty or could not be decoded
+	ErrorBody any
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s %d (%s %s)", UnexpectedStatusCodeError, e.StatusCode, e.Method, e.URL)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return UnexpectedStatusCodeError
+}
+
+// IsNotFound reports whether the response status code is 404 Not Found
+func (e *HTTPError) IsNotFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+// IsClientError reports whether the response status code is a 4xx
+func (e *HTTPError) IsClientError() bool {
+	return e.StatusCode >= 400 && e.StatusCode <= 499
+}
+
+// IsServerError reports whether the response status code is a 5xx
+func (e *HTTPError) IsServerError() bool {
+	return e.StatusCode >= 500 && e.StatusCode <= 599
+}
+
+// redactURL returns the URL with its password and sensitive query values replaced by "xxxxx"
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	ru := *u
+	if ru.RawQuery != "" {
+		q := ru.Query()
+		redacted := false
+
+		for k := range q {
+			for _, s := range sensitiveQueryParams {
+				if strings.EqualFold(k, s) {
+					q[k] = []string{"xxxxx"}
+					redacted = true
+				}
+			}
+		}
+
+		if redacted {
+			ru.RawQuery = q.Encode()
+		}
+	}
+
+	return ru.Redacted()
+}
@@ -0,0 +1,72 @@
+package gohans
+
+import (
+	"context"
+	"net/http"
+)
+
+// RequestModifier customizes a request built by the generic helpers, e.g.
+//
+//	func(r *gohans.Request) { r.SetAuthToken(token) }
+type RequestModifier func(*Request)
+
+// Get sends a GET request and returns the decoded response body
+// The response is nil if the request could not be sent
+func Get[T any](ctx context.Context, c RequestClient, url string, mods ...RequestModifier) (T, *Response, error) {
+	return send[T](ctx, c, http.MethodGet, url, nil, mods)
+}
+
+// Post sends a POST request with the encoded body and returns the decoded response body
+func Post[T any](ctx context.Context, c RequestClient, url string, body any, mods ...RequestModifier) (T, *Response, error) {
+	return send[T](ctx, c, http.MethodPost, url, body, mods)
+}
+
+// Put sends a PUT request with the encoded body and returns the decoded response body
+func Put[T any](ctx context.Context, c RequestClient, url string, body any, mods ...RequestModifier) (T, *Response, error) {
+	return send[T](ctx, c, http.MethodPut, url, body, mods)
+}
+
+// Patch sends a PATCH request with the encoded body and returns the decoded response body
+func Patch[T any](ctx context.Context, c RequestClient, url string, body any, mods ...RequestModifier) (T, *Response, error) {
+	return send[T](ctx, c, http.MethodPatch, url, body, mods)
+}
+
+// Delete sends a DELETE request and returns the decoded response body
+func Delete[T any](ctx context.Context, c RequestClient, url string, mods ...RequestModifier) (T, *Response, error) {
+	return send[T](ctx, c, http.MethodDelete, url, nil, mods)
+}
+
+// Send sends the request and returns the decoded success body of type T,
+// or the decoded error body of type E if the status code is not the expected one
+// Any response or error body set on the request is replaced
+func Send[T, E any](ctx context.Context, c RequestClient, r *Request) (T, E, error) {
+	var out T
+	var errBody E
+
+	_, err := r.SetWantedResponseBody(&out).
+		SetErrorResponseBody(&errBody).
+		Send(ctx, c)
+
+	return out, errBody, err
+}
+
+func send[T any](ctx context.Context, c RequestClient, method, url string, body any, mods []RequestModifier) (T, *Response, error) {
+	var out T
+
+	r := NewRequest().
+		SetMethod(method).
+		SetURL(url).
+		SetWantedResponseBody(&out)
+
+	if body != nil {
+		r.SetRequestBody(body)
+	}
+
+	for _, mod := range mods {
+		mod(r)
+	}
+
+	resp, err := r.Do(ctx, c)
+
+	return out, resp, err
+}
@@ -0,0 +1,131 @@
+package gohans
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func newUserServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", JSONContentType)
+		w.Header().Set("X-Method", r.Method)
+
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "user not found"}`))
+		case r.Method == http.MethodGet || r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"id": 1, "name": "hans"}`))
+		default:
+			var in user
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			in.ID = 2
+
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(in)
+		}
+	}))
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+	server := newUserServer(t)
+	defer server.Close()
+
+	u, resp, err := Get[user](ctx, client, server.URL+"/users/1")
+	assert.NoError(t, err)
+	assert.Equal(t, user{ID: 1, Name: "hans"}, u)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "GET", resp.Header.Get("X-Method"))
+	assert.JSONEq(t, `{"id": 1, "name": "hans"}`, string(resp.Body))
+
+	t.Run("pointer type", func(t *testing.T) {
+		u, _, err := Get[*user](ctx, client, server.URL+"/users/1")
+		assert.NoError(t, err)
+		assert.Equal(t, &user{ID: 1, Name: "hans"}, u)
+	})
+
+	t.Run("modifiers", func(t *testing.T) {
+		e, resp, err := Get[Error](ctx, client, server.URL+"/missing", func(r *Request) {
+			r.SetExpectedStatusCode(http.StatusNotFound)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "user not found", e.Error)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("unexpected status", func(t *testing.T) {
+		u, resp, err := Get[user](ctx, client, server.URL+"/missing")
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+		assert.Equal(t, user{}, u)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestPostPutPatchDelete(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+	server := newUserServer(t)
+	defer server.Close()
+
+	for method, call := range map[string]func() (user, *Response, error){
+		http.MethodPost: func() (user, *Response, error) {
+			return Post[user](ctx, client, server.URL+"/users", user{Name: "hans"})
+		},
+		http.MethodPut: func() (user, *Response, error) {
+			return Put[user](ctx, client, server.URL+"/users/2", user{Name: "hans"})
+		},
+		http.MethodPatch: func() (user, *Response, error) {
+			return Patch[user](ctx, client, server.URL+"/users/2", user{Name: "hans"})
+		},
+	} {
+		t.Run(method, func(t *testing.T) {
+			u, resp, err := call()
+			assert.NoError(t, err)
+			assert.Equal(t, user{ID: 2, Name: "hans"}, u)
+			assert.Equal(t, method, resp.Header.Get("X-Method"))
+		})
+	}
+
+	t.Run(http.MethodDelete, func(t *testing.T) {
+		_, resp, err := Delete[map[string]any](ctx, client, server.URL+"/users/1")
+		assert.NoError(t, err)
+		assert.Equal(t, http.MethodDelete, resp.Header.Get("X-Method"))
+	})
+}
+
+func TestSendGeneric(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+	server := newUserServer(t)
+	defer server.Close()
+
+	t.Run("success", func(t *testing.T) {
+		u, e, err := Send[user, Error](ctx, client, NewRequest().SetURL(server.URL+"/users/1"))
+		assert.NoError(t, err)
+		assert.Equal(t, user{ID: 1, Name: "hans"}, u)
+		assert.Equal(t, Error{}, e)
+	})
+
+	t.Run("error body", func(t *testing.T) {
+		r := NewRequest().SetURL(server.URL + "/missing")
+
+		u, e, err := Send[user, Error](ctx, client, r)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+		assert.Equal(t, user{}, u)
+		assert.Equal(t, "user not found", e.Error)
+		assert.Equal(t, http.StatusNotFound, r.GetStatusCode())
+	})
+}
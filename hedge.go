@@ -0,0 +1,179 @@
+package gohans
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"reflect"
+	"time"
+)
+
+// hedging sends copies of a slow request
+type hedging struct {
+	delay  time.Duration
+	copies int
+}
+
+// SetHedging sends up to copies more copies of an idempotent request, one after each delay while none has succeeded
+// The first response with the expected status code wins and the other copies are canceled. A copy failing
+// with a status code or error the retry policy considers transient is followed by the next one right away,
+// and the first error is returned if they all fail. Any other failure is returned at once
+// Requests with a streamed body or response are not hedged
+func (r *Request) SetHedging(delay time.Duration, copies int) *Request {
+	r.hedge = &hedging{delay: delay, copies: copies}
+
+	return r
+}
+
+// hedgeable reports whether copies of the request can be sent concurrently
+func (r *Request) hedgeable() bool {
+	return r.hedge != nil && r.hedge.copies > 0 && r.idempotent() &&
+		r.streamedBody() == nil && len(r.multipart) == 0 && !r.download.streaming()
+}
+
+// hedged sends copies of the request until one succeeds or they all fail
+func (r *Request) hedged(ctx context.Context, c RequestClient) (*Response, error) {
+	type result struct {
+		request *Request
+		res     *Response
+		err     error
+	}
+
+	// Failures are classified like retries, with the default predicates when no policy is set
+	policy := r.retryPolicyFor(c)
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+	}
+
+	transient := func(cp *Request, err error) bool {
+		if cp.statusCode != 0 {
+			return policy.RetryOnStatus(cp.statusCode)
+		}
+
+		return policy.RetryOnError(err)
+	}
+
+	total := r.hedge.copies + 1
+	results := make(chan result, total)
+
+	var cancels []context.CancelFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	send := func() {
+		cp := r.hedgeCopy()
+		hctx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+
+		go func() {
+			res, err := cp.execute(hctx, c)
+			results <- result{request: cp, res: res, err: err}
+		}()
+	}
+
+	send()
+
+	timer := time.NewTimer(r.hedge.delay)
+	defer timer.Stop()
+
+	var first *result
+	for pending := 1; pending > 0; {
+		select {
+		case <-timer.C:
+			if len(cancels) < total {
+				send()
+				pending++
+				timer.Reset(r.hedge.delay)
+			}
+		case res := <-results:
+			pending--
+
+			if res.err == nil {
+				r.adopt(res.request, res.res, nil)
+
+				return res.res, nil
+			}
+
+			if first == nil {
+				first = &res
+			}
+
+			if ctx.Err() != nil || !transient(res.request, res.err) {
+				r.adopt(res.request, res.res, res.err)
+
+				return res.res, res.err
+			}
+
+			if len(cancels) < total {
+				send()
+				pending++
+				timer.Reset(r.hedge.delay)
+			}
+		}
+	}
+
+	r.adopt(first.request, first.res, first.err)
+
+	return first.res, first.err
+}
+
+// hedgeCopy returns a copy of the request decoding into its own response bodies, so copies can run concurrently
+func (r *Request) hedgeCopy() *Request {
+	cp := *r
+	cp.Headers = r.Headers.Clone()
+	cp.defaulted = maps.Clone(r.defaulted)
+	cp.response = newTarget(r.response)
+	cp.errorResponse = newTarget(r.errorResponse)
+	cp.hedge = nil
+
+	return &cp
+}
+
+// adopt records the outcome of the winning copy on the request, copying its decoded bodies into the request ones
+func (r *Request) adopt(cp *Request, res *Response, err error) {
+	r.statusCode = cp.statusCode
+	r.responseHeader = cp.responseHeader
+	copyTarget(&r.response, cp.response)
+	copyTarget(&r.errorResponse, cp.errorResponse)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.ErrorBody != nil {
+		httpErr.ErrorBody = r.errorResponse
+	}
+
+	if res == nil || res.Decoded == nil {
+		return
+	}
+
+	if err == nil {
+		res.Decoded = r.response
+	} else {
+		res.Decoded = r.errorResponse
+	}
+}
+
+// newTarget returns a new value of the type a body is decoded into
+func newTarget(v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return v
+	}
+
+	return reflect.New(rv.Type().Elem()).Interface()
+}
+
+// copyTarget copies a decoded body into the target of the request
+func copyTarget(dst *any, src any) {
+	dv, sv := reflect.ValueOf(*dst), reflect.ValueOf(src)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		*dst = src
+		return
+	}
+
+	if sv.IsValid() && sv.Type() == dv.Type() && !sv.IsNil() {
+		dv.Elem().Set(sv.Elem())
+	}
+}
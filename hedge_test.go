@@ -0,0 +1,150 @@
+package gohans
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequest_hedgeable(t *testing.T) {
+	assert.False(t, NewRequest().hedgeable())
+	assert.True(t, NewRequest().SetHedging(time.Millisecond, 1).hedgeable())
+	assert.False(t, NewRequest().SetHedging(time.Millisecond, 0).hedgeable())
+	assert.False(t, NewRequest().SetMethod(http.MethodPost).SetHedging(time.Millisecond, 1).hedgeable())
+	assert.False(t, NewRequest().SetHedging(time.Millisecond, 1).SetResponseWriter(&zeroWriter{}).hedgeable())
+}
+
+type zeroWriter struct{}
+
+func (zeroWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func Test_copyTarget(t *testing.T) {
+	type body struct{ Status string }
+
+	dst := any(&body{})
+	copyTarget(&dst, &body{Status: "ok"})
+	assert.Equal(t, &body{Status: "ok"}, dst)
+
+	var empty any
+	copyTarget(&empty, map[string]any{"a": 1})
+	assert.Equal(t, map[string]any{"a": 1}, empty)
+
+	copyTarget(&dst, nil)
+	assert.Equal(t, &body{Status: "ok"}, dst)
+
+	assert.IsType(t, &body{}, newTarget(&body{}))
+	assert.Nil(t, newTarget(nil))
+}
+
+func TestRequest_SetHedging(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+
+	type status struct {
+		Status string `json:"status"`
+	}
+
+	t.Run("second copy wins", func(t *testing.T) {
+		var calls atomic.Int32
+		canceled := make(chan struct{})
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				<-r.Context().Done()
+				close(canceled)
+
+				return
+			}
+
+			w.Header().Set("Content-Type", JSONContentType)
+			w.Write([]byte(`{"status": "fast"}`))
+		}))
+		defer server.Close()
+
+		var out status
+
+		start := time.Now()
+		res, err := NewRequest().SetURL(server.URL).SetWantedResponseBody(&out).SetHedging(20*time.Millisecond, 1).Do(ctx, client)
+
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, "fast", out.Status)
+		assert.Equal(t, &out, res.Decoded)
+		assert.Equal(t, int32(2), calls.Load())
+
+		// The slow copy is canceled
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("slow copy was not canceled")
+		}
+	})
+
+	t.Run("unexpected status does not win", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", JSONContentType)
+
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error": "busy"}`))
+
+				return
+			}
+
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(`{"status": "ok"}`))
+		}))
+		defer server.Close()
+
+		var out status
+		r := NewRequest().SetURL(server.URL).SetWantedResponseBody(&out).SetHedging(time.Second, 2)
+
+		_, err := r.Do(ctx, client)
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", out.Status)
+		assert.Equal(t, http.StatusOK, r.GetStatusCode())
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("all copies fail", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Content-Type", JSONContentType)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error": "busy"}`))
+		}))
+		defer server.Close()
+
+		errBody := &Error{}
+		r := NewRequest().SetURL(server.URL).SetErrorResponseBody(errBody).SetHedging(time.Millisecond, 2)
+
+		res, err := r.Do(ctx, client)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+		assert.Equal(t, "busy", errBody.Error)
+		assert.Equal(t, errBody, res.Decoded)
+		assert.Equal(t, http.StatusServiceUnavailable, r.GetStatusCode())
+		assert.Equal(t, int32(3), calls.Load())
+	})
+	t.Run("final status is not hedged", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		r := NewRequest().SetURL(server.URL).SetHedging(time.Second, 3)
+
+		_, err := r.Do(ctx, client)
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+		assert.Equal(t, http.StatusNotFound, r.GetStatusCode())
+		assert.Equal(t, int32(1), calls.Load())
+	})
+}
@@ -1,20 +1,91 @@
 package gohans
 
 import (
-	"encoding/json"
-	"encoding/xml"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
-// decodeResponse decodes the response body into the result interface
-func decodeResponse(resp *http.Response, result interface{}) error {
-	switch resp.Header.Get("Content-Type") {
-	case "application/json":
-		return json.NewDecoder(resp.Body).Decode(&result)
-	case "application/xml":
-		return xml.NewDecoder(resp.Body).Decode(&result)
-	default:
-		return errors.New("invalid content type")
+var (
+	InvalidContentTypeError = errors.New("invalid content type")
+	MissingPathParamError   = errors.New("missing path parameter")
+)
+
+// decodeResponse decodes the body into the result interface
+// The codec is picked from the response Content-Type header; when no codec is registered for it,
+// the fallback content types are tried in order
+func decodeResponse(codecs codecRegistry, resp *http.Response, body io.Reader, result any, fallbacks ...string) error {
+	codec, ok := codecs.lookup(resp.Header.Get("Content-Type"))
+	for i := 0; !ok && i < len(fallbacks); i++ {
+		codec, ok = codecs.lookup(fallbacks[i])
+	}
+
+	if !ok {
+		return InvalidContentTypeError
 	}
+
+	return codec.Decode(body, result)
+}
+
+// decodeTarget returns the value a body should be decoded into
+// If no value was provided, the body is decoded into the interface itself
+func decodeTarget(v *any) any {
+	if *v == nil {
+		return v
+	}
+
+	return *v
+}
+
+// firstMediaType returns the first media range of an Accept header value
+func firstMediaType(accept string) string {
+	first, _, _ := strings.Cut(accept, ",")
+
+	return first
+}
+
+// expandPath replaces {name} placeholders in a path template with escaped parameter values
+// The leading slash is dropped so the path resolves relative to the base URL path
+func expandPath(template string, params map[string]string) (string, error) {
+	var b strings.Builder
+
+	rest := strings.TrimPrefix(template, "/")
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			break
+		}
+
+		name := rest[start+1 : start+end]
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("%w: %s", MissingPathParamError, name)
+		}
+
+		b.WriteString(rest[:start])
+		b.WriteString(escapePathSegment(value))
+		rest = rest[start+end+1:]
+	}
+
+	b.WriteString(rest)
+
+	return b.String(), nil
+}
+
+// escapePathSegment escapes a value so it stays a single path segment
+// Dot segments are escaped too, so they are not resolved as parent or current directory
+func escapePathSegment(value string) string {
+	if value == "." || value == ".." {
+		return strings.Repeat("%2E", len(value))
+	}
+
+	return url.PathEscape(value)
 }
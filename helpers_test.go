@@ -10,6 +10,8 @@ import (
 )
 
 func Test_decodeResponse(t *testing.T) {
+	codecs := defaultCodecs()
+
 	t.Run("json", func(t *testing.T) {
 
 		body := `{"key": "value"}`
@@ -21,7 +23,7 @@ func Test_decodeResponse(t *testing.T) {
 		}
 
 		result := map[string]interface{}{}
-		err := decodeResponse(resp, &result)
+		err := decodeResponse(codecs, resp, resp.Body, &result)
 		assert.NoError(t, err)
 		assert.Equal(t, map[string]interface{}{"key": "value"}, result)
 	})
@@ -38,11 +40,43 @@ func Test_decodeResponse(t *testing.T) {
 		result := struct {
 			Key string `xml:"key"`
 		}{}
-		err := decodeResponse(resp, &result)
+		err := decodeResponse(codecs, resp, resp.Body, &result)
+		assert.NoError(t, err)
+		assert.Equal(t, "value", result.Key)
+	})
+
+	t.Run("content type parameters", func(t *testing.T) {
+		body := `<struct><key>value</key></struct>`
+		resp := &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"text/xml; charset=utf-8"},
+			},
+			Body: io.NopCloser(strings.NewReader(body)),
+		}
+
+		result := struct {
+			Key string `xml:"key"`
+		}{}
+		err := decodeResponse(codecs, resp, resp.Body, &result)
 		assert.NoError(t, err)
 		assert.Equal(t, "value", result.Key)
 	})
 
+	t.Run("fallback content type", func(t *testing.T) {
+		body := `{"key": "value"}`
+		resp := &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"text/plain; charset=utf-8"},
+			},
+			Body: io.NopCloser(strings.NewReader(body)),
+		}
+
+		result := map[string]interface{}{}
+		err := decodeResponse(codecs, resp, resp.Body, &result, "", JSONContentType)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"key": "value"}, result)
+	})
+
 	t.Run("invalid content type", func(t *testing.T) {
 		resp := &http.Response{
 			Header: http.Header{
@@ -50,8 +84,50 @@ func Test_decodeResponse(t *testing.T) {
 			},
 		}
 
-		err := decodeResponse(resp, nil)
+		err := decodeResponse(codecs, resp, resp.Body, nil)
 		assert.Error(t, err)
 		assert.Equal(t, "invalid content type", err.Error())
 	})
 }
+
+func Test_decodeTarget(t *testing.T) {
+	var empty any
+	assert.Equal(t, &empty, decodeTarget(&empty))
+
+	v := &struct{}{}
+	var set any = v
+	assert.Equal(t, v, decodeTarget(&set))
+}
+
+func Test_firstMediaType(t *testing.T) {
+	assert.Equal(t, "application/json", firstMediaType("application/json, text/plain;q=0.5"))
+	assert.Equal(t, "", firstMediaType(""))
+}
+
+func Test_expandPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		params   map[string]string
+		want     string
+		err      error
+	}{
+		{"no params", "/users", nil, "users", nil},
+		{"params", "/users/{id}/orders/{orderID}", map[string]string{"id": "42", "orderID": "a-1"}, "users/42/orders/a-1", nil},
+		{"escaping", "/files/{name}", map[string]string{"name": "a b/c?d#e"}, "files/a%20b%2Fc%3Fd%23e", nil},
+		{"dot segments", "/users/{id}/{sub}", map[string]string{"id": "..", "sub": "."}, "users/%2E%2E/%2E", nil},
+		{"unclosed brace", "/users/{id", nil, "users/{id", nil},
+		{"missing param", "/users/{id}", map[string]string{"other": "1"}, "", MissingPathParamError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandPath(tt.template, tt.params)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := expandPath("/users/{id}", nil)
+	assert.EqualError(t, err, "missing path parameter: id")
+}
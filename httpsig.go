@@ -0,0 +1,627 @@
+package gohans
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidSignatureError      = errors.New("invalid message signature")
+	UnsupportedKeyError        = errors.New("unsupported message signature key")
+	ContentDigestMismatchError = errors.New("content digest mismatch")
+)
+
+const (
+	// DefaultSignatureLabel labels the signatures of a MessageSigner unless set
+	DefaultSignatureLabel = "sig1"
+
+	// maxSignatureSkew is how far in the future the creation time of a verified signature may be
+	maxSignatureSkew = time.Minute
+)
+
+// defaultSignatureComponents are covered by a MessageSigner without components
+var defaultSignatureComponents = []string{"@method", "@target-uri", "@authority"}
+
+// MessageSigner signs requests with HTTP message signatures, as defined by RFC 9421
+type MessageSigner struct {
+	KeyID string
+	// Key is an ed25519.PrivateKey, a P-256 *ecdsa.PrivateKey or an HMAC-SHA256 secret as []byte
+	Key any
+	// Label names the signature in the Signature and Signature-Input headers, DefaultSignatureLabel when empty
+	Label string
+	// Components are the covered derived components and header names, @method, @target-uri and @authority when empty
+	Components []string
+	// ContentDigest sets a Content-Digest header (RFC 9530) on requests with a body, and covers it
+	ContentDigest bool
+	// Tag is sent as the tag signature parameter when set
+	Tag string
+	// Expires sets the expires signature parameter this long after the signature is created
+	Expires time.Duration
+	// Now returns the signing time, time.Now when nil
+	Now func() time.Time
+}
+
+// WithMessageSigner signs every request sent by the client with an HTTP message signature
+// The signer runs after all middleware, so headers they set are covered, and before the Authenticator,
+// so credentials are not
+func WithMessageSigner(s MessageSigner) RequestOption {
+	return func(c *Client) {
+		if _, err := signatureAlgorithm(s.Key); err != nil {
+			c.err = err
+			return
+		}
+
+		c.signer = &s
+	}
+}
+
+// wrap signs the request before sending it
+func (s MessageSigner) wrap(next RoundTripFunc, logger *slog.Logger) RoundTripFunc {
+	return func(r *Request, req *http.Request) (*http.Response, error) {
+		if err := s.Sign(req); err != nil {
+			logger.Error("error signing request", "error", err)
+			return nil, err
+		}
+
+		return next(r, req)
+	}
+}
+
+// Sign sets the Signature and Signature-Input headers of the request, and its Content-Digest if enabled
+func (s MessageSigner) Sign(req *http.Request) error {
+	if _, err := signatureAlgorithm(s.Key); err != nil {
+		return err
+	}
+
+	components := s.Components
+	if len(components) == 0 {
+		components = defaultSignatureComponents
+	}
+
+	if s.ContentDigest && req.Body != nil && req.Body != http.NoBody {
+		digest, err := bodySum(req, sha256.New())
+		if err != nil {
+			return fmt.Errorf("content digest: %w", err)
+		}
+
+		req.Header.Set("Content-Digest", formatDigest("sha-256", digest))
+		components = append(components[:len(components):len(components)], "content-digest")
+	}
+
+	created := signingTime(s.Now)
+
+	var params strings.Builder
+	params.WriteString("(")
+	for i, c := range components {
+		if i > 0 {
+			params.WriteString(" ")
+		}
+
+		params.WriteString(strconv.Quote(strings.ToLower(c)))
+	}
+
+	fmt.Fprintf(&params, ");created=%d", created.Unix())
+	if s.Expires > 0 {
+		fmt.Fprintf(&params, ";expires=%d", created.Add(s.Expires).Unix())
+	}
+
+	if s.KeyID != "" {
+		fmt.Fprintf(&params, ";keyid=%s", strconv.Quote(s.KeyID))
+	}
+
+	if s.Tag != "" {
+		fmt.Fprintf(&params, ";tag=%s", strconv.Quote(s.Tag))
+	}
+
+	base, err := signatureBase(requestMessage(req), parseSignatureInput(params.String()))
+	if err != nil {
+		return err
+	}
+
+	sig, err := signBase(s.Key, []byte(base))
+	if err != nil {
+		return err
+	}
+
+	label := s.Label
+	if label == "" {
+		label = DefaultSignatureLabel
+	}
+
+	req.Header.Set("Signature-Input", label+"="+params.String())
+	req.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+
+	return nil
+}
+
+// MessageVerifier verifies HTTP message signatures, as defined by RFC 9421
+type MessageVerifier struct {
+	// Keys maps key ids to ed25519.PublicKey, P-256 *ecdsa.PublicKey or HMAC-SHA256 []byte secrets
+	Keys map[string]any
+	// Label is the signature verified, the first one of the message when empty
+	Label string
+	// Required are components the signature must cover, e.g. @status or content-digest
+	Required []string
+	// MaxAge rejects signatures created longer ago, no limit when zero
+	MaxAge time.Duration
+	// Now returns the verification time, time.Now when nil
+	Now func() time.Time
+}
+
+// VerifyResponse verifies the signature of a response to a request
+// Components with the req parameter are taken from the request. A covered Content-Digest is checked against the body
+func (v MessageVerifier) VerifyResponse(r *Request, resp *Response) error {
+	req := &signedMessage{method: r.Method, url: resp.URL, header: r.Headers, contentLength: -1}
+	if req.method == "" {
+		req.method = http.MethodGet
+	}
+
+	msg := &signedMessage{status: resp.StatusCode, header: resp.Header, contentLength: -1, request: req}
+
+	return v.verify(msg, resp.Body)
+}
+
+// VerifyRequest verifies the signature of a received request, with body the content of the request body
+// A covered Content-Digest is checked against the body
+func (v MessageVerifier) VerifyRequest(req *http.Request, body []byte) error {
+	// Received requests only have the path in their URL
+	msg := requestMessage(req)
+	if msg.url.Scheme == "" {
+		u := *msg.url
+		u.Scheme = "http"
+		if req.TLS != nil {
+			u.Scheme = "https"
+		}
+
+		msg.url = &u
+	}
+
+	return v.verify(msg, body)
+}
+
+func (v MessageVerifier) verify(msg *signedMessage, body []byte) error {
+	inputs := splitDictionary(strings.Join(msg.header.Values("Signature-Input"), ","))
+	signatures := splitDictionary(strings.Join(msg.header.Values("Signature"), ","))
+
+	label := v.Label
+	if label == "" && len(inputs) > 0 {
+		label = inputs[0].key
+	}
+
+	input, ok := dictionaryValue(inputs, label)
+	if !ok {
+		return fmt.Errorf("%w: no signature input %q", InvalidSignatureError, label)
+	}
+
+	encoded, ok := dictionaryValue(signatures, label)
+	if !ok || len(encoded) < 2 || encoded[0] != ':' || encoded[len(encoded)-1] != ':' {
+		return fmt.Errorf("%w: no signature %q", InvalidSignatureError, label)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(encoded[1 : len(encoded)-1])
+	if err != nil {
+		return fmt.Errorf("%w: %w", InvalidSignatureError, err)
+	}
+
+	params := parseSignatureInput(input)
+	if params == nil {
+		return fmt.Errorf("%w: malformed signature input", InvalidSignatureError)
+	}
+
+	for _, required := range v.Required {
+		if !params.covers(strings.ToLower(required)) {
+			return fmt.Errorf("%w: %s is not covered", InvalidSignatureError, required)
+		}
+	}
+
+	now := signingTime(v.Now)
+	if created, ok := params.time("created"); ok {
+		if created.After(now.Add(maxSignatureSkew)) || v.MaxAge > 0 && now.Sub(created) > v.MaxAge {
+			return fmt.Errorf("%w: created at %s", InvalidSignatureError, created)
+		}
+	} else if v.MaxAge > 0 {
+		return fmt.Errorf("%w: no creation time", InvalidSignatureError)
+	}
+
+	if expires, ok := params.time("expires"); ok && now.After(expires) {
+		return fmt.Errorf("%w: expired at %s", InvalidSignatureError, expires)
+	}
+
+	keyID := params.params["keyid"]
+	key, ok := v.Keys[keyID]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", InvalidSignatureError, keyID)
+	}
+
+	if alg, ok := params.params["alg"]; ok {
+		if expected, err := signatureAlgorithm(key); err != nil || alg != expected {
+			return fmt.Errorf("%w: algorithm %q does not match the key", InvalidSignatureError, alg)
+		}
+	}
+
+	base, err := signatureBase(msg, params)
+	if err != nil {
+		return fmt.Errorf("%w: %w", InvalidSignatureError, err)
+	}
+
+	if err := verifyBase(key, []byte(base), sig); err != nil {
+		return err
+	}
+
+	if params.covers("content-digest") {
+		return VerifyContentDigest(msg.header.Get("Content-Digest"), body)
+	}
+
+	return nil
+}
+
+// ContentDigest returns a Content-Digest header value with the SHA-256 digest of the content, as defined by RFC 9530
+func ContentDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return formatDigest("sha-256", sum[:])
+}
+
+func formatDigest(algorithm string, sum []byte) string {
+	return algorithm + "=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+}
+
+// VerifyContentDigest checks the sha-256 and sha-512 digests of a Content-Digest header value against the content
+// It fails when the header has neither
+func VerifyContentDigest(header string, content []byte) error {
+	checked := false
+	for _, entry := range splitDictionary(header) {
+		var h hash.Hash
+		switch entry.key {
+		case "sha-256":
+			h = sha256.New()
+		case "sha-512":
+			h = sha512.New()
+		default:
+			continue
+		}
+
+		h.Write(content)
+		if entry.key+"="+entry.value != formatDigest(entry.key, h.Sum(nil)) {
+			return fmt.Errorf("%w: %s", ContentDigestMismatchError, entry.key)
+		}
+
+		checked = true
+	}
+
+	if !checked {
+		return fmt.Errorf("%w: no sha-256 or sha-512 digest", ContentDigestMismatchError)
+	}
+
+	return nil
+}
+
+// signatureAlgorithm returns the RFC 9421 algorithm name of a signing or verification key
+func signatureAlgorithm(key any) (string, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return "ed25519", nil
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P256() {
+			return "ecdsa-p256-sha256", nil
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return "ecdsa-p256-sha256", nil
+		}
+	case []byte:
+		return "hmac-sha256", nil
+	}
+
+	return "", fmt.Errorf("%w: %T", UnsupportedKeyError, key)
+}
+
+func signBase(key any, base []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, base), nil
+	case *ecdsa.PrivateKey:
+		sum := sha256.Sum256(base)
+		r, s, err := ecdsa.Sign(rand.Reader, k, sum[:])
+		if err != nil {
+			return nil, err
+		}
+
+		// The signature is the fixed size concatenation of r and s, not ASN.1
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+
+		return sig, nil
+	case []byte:
+		h := hmac.New(sha256.New, k)
+		h.Write(base)
+
+		return h.Sum(nil), nil
+	}
+
+	return nil, fmt.Errorf("%w: %T", UnsupportedKeyError, key)
+}
+
+func verifyBase(key any, base, sig []byte) error {
+	valid := false
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, base, sig)
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(base)
+		valid = len(sig) == 64 && ecdsa.Verify(k, sum[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+	case []byte:
+		h := hmac.New(sha256.New, k)
+		h.Write(base)
+		valid = hmac.Equal(h.Sum(nil), sig)
+	default:
+		return fmt.Errorf("%w: %T", UnsupportedKeyError, key)
+	}
+
+	if !valid {
+		return fmt.Errorf("%w: signature does not match", InvalidSignatureError)
+	}
+
+	return nil
+}
+
+// signedMessage is the request or response a signature base is built from
+type signedMessage struct {
+	method        string
+	url           *url.URL
+	status        int
+	header        http.Header
+	contentLength int64
+	// request is the request of a response, for components with the req parameter
+	request *signedMessage
+}
+
+func requestMessage(req *http.Request) *signedMessage {
+	contentLength := int64(-1)
+	if req.Body != nil && req.Body != http.NoBody {
+		contentLength = req.ContentLength
+	}
+
+	u := req.URL
+	if req.Host != "" && req.Host != u.Host {
+		cp := *u
+		cp.Host = req.Host
+		u = &cp
+	}
+
+	return &signedMessage{method: req.Method, url: u, header: req.Header, contentLength: contentLength}
+}
+
+// component returns the value of a derived component or header field
+func (m *signedMessage) component(name string) (string, error) {
+	switch name {
+	case "@method":
+		return m.method, nil
+	case "@target-uri":
+		return m.url.String(), nil
+	case "@authority":
+		return strings.ToLower(stripDefaultPort(m.url.Scheme, m.url.Host)), nil
+	case "@scheme":
+		return strings.ToLower(m.url.Scheme), nil
+	case "@request-target":
+		return m.url.RequestURI(), nil
+	case "@path":
+		if p := m.url.EscapedPath(); p != "" {
+			return p, nil
+		}
+
+		return "/", nil
+	case "@query":
+		return "?" + m.url.RawQuery, nil
+	case "@status":
+		if m.status == 0 {
+			return "", errors.New("@status is only defined for responses")
+		}
+
+		return strconv.Itoa(m.status), nil
+	}
+
+	if strings.HasPrefix(name, "@") {
+		return "", fmt.Errorf("unsupported derived component %s", name)
+	}
+
+	values := m.header.Values(name)
+	if len(values) == 0 && name == "content-length" && m.contentLength >= 0 {
+		values = []string{strconv.FormatInt(m.contentLength, 10)}
+	}
+
+	if len(values) == 0 {
+		return "", fmt.Errorf("missing header %s", name)
+	}
+
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+
+	return strings.Join(trimmed, ", "), nil
+}
+
+// signatureBase builds the signature base of RFC 9421 section 2.5
+func signatureBase(msg *signedMessage, params *signatureParams) (string, error) {
+	if params == nil {
+		return "", errors.New("malformed signature input")
+	}
+
+	var b strings.Builder
+	for _, c := range params.components {
+		m := msg
+		if c.req {
+			if msg.request == nil {
+				return "", fmt.Errorf("%s;req is only defined for responses", c.name)
+			}
+
+			m = msg.request
+		}
+
+		value, err := m.component(c.name)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "%s: %s\n", c.raw, value)
+	}
+
+	fmt.Fprintf(&b, `"@signature-params": %s`, params.raw)
+
+	return b.String(), nil
+}
+
+// signatureParams is a parsed Signature-Input entry
+type signatureParams struct {
+	raw        string
+	components []signatureComponent
+	params     map[string]string
+}
+
+type signatureComponent struct {
+	// raw is the serialized component identifier, e.g. "@method";req
+	raw  string
+	name string
+	req  bool
+}
+
+func (p *signatureParams) covers(name string) bool {
+	for _, c := range p.components {
+		if c.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *signatureParams) time(name string) (time.Time, bool) {
+	v, ok := p.params[name]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(n, 0), true
+}
+
+// parseSignatureInput parses an inner list of component identifiers followed by signature parameters
+// It returns nil when the input is malformed
+func parseSignatureInput(s string) *signatureParams {
+	s = strings.TrimSpace(s)
+	end := strings.IndexByte(s, ')')
+	if !strings.HasPrefix(s, "(") || end < 0 {
+		return nil
+	}
+
+	p := &signatureParams{raw: s, params: map[string]string{}}
+
+	for _, item := range strings.Fields(s[1:end]) {
+		name, itemParams, _ := strings.Cut(item, ";")
+		unquoted, err := strconv.Unquote(name)
+		if err != nil {
+			return nil
+		}
+
+		c := signatureComponent{raw: item, name: unquoted}
+		for _, param := range strings.Split(itemParams, ";") {
+			switch param {
+			case "":
+			case "req":
+				c.req = true
+			default:
+				// sf, key, bs and name parameters are not supported
+				return nil
+			}
+		}
+
+		p.components = append(p.components, c)
+	}
+
+	for _, param := range strings.Split(s[end+1:], ";") {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+
+		p.params[strings.TrimSpace(key)] = value
+	}
+
+	return p
+}
+
+// dictionaryEntry is an entry of a structured field dictionary
+type dictionaryEntry struct {
+	key   string
+	value string
+}
+
+// splitDictionary splits a structured field dictionary on the commas outside of strings and inner lists
+func splitDictionary(s string) []dictionaryEntry {
+	var entries []dictionaryEntry
+
+	add := func(member string) {
+		key, value, _ := strings.Cut(strings.TrimSpace(member), "=")
+		if key != "" {
+			entries = append(entries, dictionaryEntry{key: key, value: value})
+		}
+	}
+
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			add(s[start:i])
+			start = i + 1
+		}
+	}
+
+	add(s[start:])
+
+	return entries
+}
+
+func dictionaryValue(entries []dictionaryEntry, key string) (string, bool) {
+	for _, e := range entries {
+		if e.key == key {
+			return e.value, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,234 @@
+package gohans
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfc9421Request is the test request of RFC 9421 appendix B.2
+func rfc9421Request() *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+
+	return req
+}
+
+func TestMessageSigner_rfc9421(t *testing.T) {
+	created := func() time.Time { return time.Unix(1618884473, 0) }
+
+	t.Run("ed25519", func(t *testing.T) {
+		// RFC 9421 appendix B.2.6
+		der, _ := base64.StdEncoding.DecodeString("MC4CAQAwBQYDK2VwBCIEIJ+DYvh6SEqVTm50DFtMDoQikTmiCqirVv9mWG9qfSnF")
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		assert.NoError(t, err)
+
+		req := rfc9421Request()
+		err = MessageSigner{
+			KeyID:      "test-key-ed25519",
+			Key:        key,
+			Components: []string{"date", "@method", "@path", "@authority", "content-type", "content-length"},
+			Now:        created,
+		}.Sign(req)
+		assert.NoError(t, err)
+
+		assert.Equal(t, `sig1=("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`, req.Header.Get("Signature-Input"))
+		assert.Equal(t, "sig1=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:", req.Header.Get("Signature"))
+	})
+
+	t.Run("hmac-sha256", func(t *testing.T) {
+		// RFC 9421 appendix B.2.5
+		secret, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+
+		req := rfc9421Request()
+		err := MessageSigner{
+			KeyID:      "test-shared-secret",
+			Key:        secret,
+			Components: []string{"date", "@authority", "content-type"},
+			Now:        created,
+		}.Sign(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "sig1=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:", req.Header.Get("Signature"))
+	})
+}
+
+func Test_signatureBase(t *testing.T) {
+	req := rfc9421Request()
+	req.Header.Add("X-Multi", " a ")
+	req.Header.Add("X-Multi", "b")
+
+	base, err := signatureBase(requestMessage(req), parseSignatureInput(
+		`("@method" "@target-uri" "@authority" "@scheme" "@request-target" "@path" "@query" "x-multi");keyid="k"`))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		`"@method": POST`,
+		`"@target-uri": https://example.com/foo?param=Value&Pet=dog`,
+		`"@authority": example.com`,
+		`"@scheme": https`,
+		`"@request-target": /foo?param=Value&Pet=dog`,
+		`"@path": /foo`,
+		`"@query": ?param=Value&Pet=dog`,
+		`"x-multi": a, b`,
+		`"@signature-params": ("@method" "@target-uri" "@authority" "@scheme" "@request-target" "@path" "@query" "x-multi");keyid="k"`,
+	}, "\n"), base)
+
+	_, err = signatureBase(requestMessage(req), parseSignatureInput(`("x-missing")`))
+	assert.ErrorContains(t, err, "missing header x-missing")
+
+	_, err = signatureBase(requestMessage(req), parseSignatureInput(`("@status")`))
+	assert.Error(t, err)
+
+	assert.Nil(t, parseSignatureInput(`("x-dict";key="a")`))
+	assert.Nil(t, parseSignatureInput(`"@method"`))
+}
+
+func TestMessageVerifier(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("shared")
+
+	keys := map[string]any{"ec": &ecKey.PublicKey, "ed": edPublic, "hmac": secret}
+	now := time.Now()
+
+	for name, key := range map[string]any{"ec": ecKey, "ed": edKey, "hmac": secret} {
+		t.Run(name, func(t *testing.T) {
+			req := rfc9421Request()
+			assert.NoError(t, MessageSigner{KeyID: name, Key: key, ContentDigest: true}.Sign(req))
+
+			body, _ := io.ReadAll(req.Body)
+			v := MessageVerifier{Keys: keys, Required: []string{"@method", "content-digest"}}
+			assert.NoError(t, v.VerifyRequest(req, body))
+
+			assert.ErrorIs(t, v.VerifyRequest(req, []byte(`{"hello": "tampered"}`)), ContentDigestMismatchError)
+
+			req.Method = http.MethodPut
+			assert.ErrorIs(t, v.VerifyRequest(req, body), InvalidSignatureError)
+		})
+	}
+
+	t.Run("checks", func(t *testing.T) {
+		sign := func(s MessageSigner) *http.Request {
+			req := rfc9421Request()
+			s.Key = secret
+			s.KeyID = "hmac"
+			assert.NoError(t, s.Sign(req))
+
+			return req
+		}
+
+		v := MessageVerifier{Keys: keys, MaxAge: time.Minute}
+
+		old := sign(MessageSigner{Now: func() time.Time { return now.Add(-time.Hour) }})
+		assert.ErrorContains(t, v.VerifyRequest(old, nil), "created at")
+
+		expired := sign(MessageSigner{Now: func() time.Time { return now.Add(-30 * time.Second) }, Expires: time.Second})
+		assert.ErrorContains(t, v.VerifyRequest(expired, nil), "expired at")
+
+		uncovered := sign(MessageSigner{Components: []string{"@method"}})
+		assert.ErrorContains(t, MessageVerifier{Keys: keys, Required: []string{"@authority"}}.VerifyRequest(uncovered, nil), "@authority is not covered")
+
+		assert.ErrorContains(t, MessageVerifier{}.VerifyRequest(uncovered, nil), `unknown key "hmac"`)
+		assert.ErrorContains(t, MessageVerifier{Keys: keys, Label: "sig2"}.VerifyRequest(uncovered, nil), `no signature input "sig2"`)
+
+		wrongAlg := sign(MessageSigner{})
+		wrongAlg.Header.Set("Signature-Input", strings.Replace(wrongAlg.Header.Get("Signature-Input"), `keyid="hmac"`, `keyid="hmac";alg="ed25519"`, 1))
+		assert.ErrorContains(t, v.VerifyRequest(wrongAlg, nil), "does not match the key")
+	})
+}
+
+func TestWithMessageSigner(t *testing.T) {
+	ctx := context.Background()
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	verifier := MessageVerifier{Keys: map[string]any{"client": public}, Required: []string{"@method", "@target-uri", "content-digest"}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := verifier.VerifyRequest(r, body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "` + err.Error() + `"}`))
+			return
+		}
+
+		// The response is signed with the same key, covering the request method
+		resp := &http.Request{Method: r.Method, URL: r.URL, Header: w.Header()}
+		w.Header().Set("Content-Type", JSONContentType)
+		w.Header().Set("Content-Digest", ContentDigest([]byte(`{"status": "ok"}`)))
+
+		base, err := signatureBase(
+			&signedMessage{status: http.StatusOK, header: w.Header(), request: requestMessage(resp)},
+			parseSignatureInput(`("@status" "content-digest" "@method";req);keyid="server"`))
+		assert.NoError(t, err)
+
+		sig, _ := signBase(private, []byte(base))
+		w.Header().Set("Signature-Input", `sig1=("@status" "content-digest" "@method";req);keyid="server"`)
+		w.Header().Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(sig)+":")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(ctx, WithMessageSigner(MessageSigner{KeyID: "client", Key: private, ContentDigest: true}))
+
+	r := NewRequest().SetMethod(http.MethodPost).SetURL(server.URL + "/items?page=1").SetRequestBody(map[string]string{"name": "gohans"})
+	resp, err := r.Do(ctx, client)
+	assert.NoError(t, err)
+
+	responseVerifier := MessageVerifier{Keys: map[string]any{"server": public}, Required: []string{"@status", "content-digest"}}
+	assert.NoError(t, responseVerifier.VerifyResponse(r, resp))
+
+	resp.Body = []byte(`{"status": "tampered"}`)
+	assert.ErrorIs(t, responseVerifier.VerifyResponse(r, resp), ContentDigestMismatchError)
+
+	client = NewClient(ctx, WithMessageSigner(MessageSigner{Key: "not a key"}))
+	_, err = NewRequest().SetURL(server.URL).Send(ctx, client)
+	assert.ErrorIs(t, err, UnsupportedKeyError)
+
+	t.Run("signs after middleware", func(t *testing.T) {
+		tenantVerifier := MessageVerifier{Keys: map[string]any{"client": public}, Required: []string{"x-tenant"}}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, tenantVerifier.VerifyRequest(r, nil))
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		// The middleware registered after the signer still runs before it
+		client := NewClient(ctx,
+			WithMessageSigner(MessageSigner{KeyID: "client", Key: private, Components: []string{"@method", "x-tenant"}}),
+			WithMiddleware(HeadersMiddleware(http.Header{"X-Tenant": {"acme"}})),
+		)
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.NoError(t, err)
+	})
+}
+
+func TestVerifyContentDigest(t *testing.T) {
+	content := []byte(`{"hello": "world"}`)
+
+	// RFC 9530 appendix B.1
+	assert.NoError(t, VerifyContentDigest("sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", content))
+	assert.Equal(t, "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", ContentDigest(content))
+
+	assert.ErrorIs(t, VerifyContentDigest("sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", []byte("other")), ContentDigestMismatchError)
+	assert.ErrorIs(t, VerifyContentDigest("md5=:abc=:", content), ContentDigestMismatchError)
+}
+
+func Test_splitDictionary(t *testing.T) {
+	assert.Equal(t, []dictionaryEntry{
+		{key: "sig1", value: `("@method" "x");keyid="a,b"`},
+		{key: "sig2", value: ":YQ==:"},
+	}, splitDictionary(`sig1=("@method" "x");keyid="a,b", sig2=:YQ==:`))
+}
@@ -0,0 +1,114 @@
+package gohans
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+// RoundTripFunc sends the outgoing http request built for a gohans Request and returns the response
+type RoundTripFunc func(r *Request, req *http.Request) (*http.Response, error)
+
+// Middleware wraps a RoundTripFunc to add behavior around sending a request,
+// such as signing, tracing, metrics or inspecting the response
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// WithMiddleware appends middleware to the client chain
+// Middleware runs in registration order: the first one registered sees the request first and the response last
+func WithMiddleware(mw ...Middleware) RequestOption {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, mw...)
+	}
+}
+
+// roundTrip sends the request through the middleware chain
+func (c *Client) roundTrip(r *Request, req *http.Request) (*http.Response, error) {
+	next := func(_ *Request, req *http.Request) (*http.Response, error) {
+		markSent(req.Context())
+
+		return c.httpClient.Do(req)
+	}
+
+	// Credentials are added last, so they cover the request as modified by middleware
+	if c.authenticator != nil {
+		next = c.authenticate(next)
+	}
+
+	// Signatures cover the request as modified by middleware, but not the credentials
+	if c.signer != nil {
+		next = c.signer.wrap(next, c.logger)
+	}
+
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		next = c.middleware[i](next)
+	}
+
+	// Requests are paced before the middleware, so signatures and timestamps are fresh when sent
+	if c.rateLimiter != nil {
+		next = c.rateLimiter.wrap(next)
+	}
+
+	// A slot is held from before waiting for a rate limit token until the response body is closed
+	if c.bulkhead != nil {
+		next = c.bulkhead.wrap(next)
+	}
+
+	// An open circuit fails fast, without waiting for a slot or a rate limit token
+	if c.breakers != nil {
+		next = c.breakers.wrap(next, c.logger)
+	}
+
+	return next(r, req)
+}
+
+// HeadersMiddleware sets static headers on every request, replacing values set on the request
+func HeadersMiddleware(headers http.Header) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(r *Request, req *http.Request) (*http.Response, error) {
+			for k, v := range headers {
+				req.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+			}
+
+			return next(r, req)
+		}
+	}
+}
+
+// UserAgentMiddleware sets the User-Agent header on every request
+func UserAgentMiddleware(userAgent string) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(r *Request, req *http.Request) (*http.Response, error) {
+			req.Header.Set("User-Agent", userAgent)
+
+			return next(r, req)
+		}
+	}
+}
+
+// RequestIDMiddleware adds a random request ID header to requests that do not carry one already
+// The header defaults to X-Request-Id when empty
+func RequestIDMiddleware(header string) Middleware {
+	if header == "" {
+		header = RequestIDHeader
+	}
+
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(r *Request, req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) == "" {
+				req.Header.Set(header, newRequestID())
+			}
+
+			return next(r, req)
+		}
+	}
+}
+
+// newRequestID returns a random 128 bit hex encoded ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
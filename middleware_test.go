@@ -0,0 +1,139 @@
+package gohans
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	ctx := context.Background()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(r *Request, req *http.Request) (*http.Response, error) {
+				order = append(order, name+" before")
+				resp, err := next(r, req)
+				order = append(order, name+" after")
+
+				return resp, err
+			}
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "server")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(ctx, WithMiddleware(trace("first"), trace("second")), WithMiddleware(trace("third")))
+	assert.Len(t, client.middleware, 3)
+
+	_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"first before", "second before", "third before",
+		"server",
+		"third after", "second after", "first after",
+	}, order)
+}
+
+func TestMiddleware_requestMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "list-users", r.Header.Get("X-Operation"))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var status int
+	client := NewClient(ctx, WithMiddleware(func(next RoundTripFunc) RoundTripFunc {
+		return func(r *Request, req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Operation", r.GetMetadata("operation").(string))
+			resp, err := next(r, req)
+			if err == nil {
+				status = resp.StatusCode
+			}
+
+			return resp, err
+		}
+	}))
+
+	_, err := NewRequest().SetURL(server.URL).SetMetadata("operation", "list-users").Send(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestMiddleware_shortCircuit(t *testing.T) {
+	ctx := context.Background()
+
+	client := NewClient(ctx, WithMiddleware(func(next RoundTripFunc) RoundTripFunc {
+		return func(r *Request, req *http.Request) (*http.Response, error) {
+			rec := httptest.NewRecorder()
+			rec.WriteHeader(http.StatusOK)
+			rec.WriteString(`{"status": "cached"}`)
+
+			return rec.Result(), nil
+		}
+	}))
+
+	var ok struct {
+		Status string `json:"status"`
+	}
+
+	_, err := NewRequest().SetURL("http://localhost:0").SetWantedResponseBody(&ok).Send(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, "cached", ok.Status)
+}
+
+func TestBuiltinMiddleware(t *testing.T) {
+	ctx := context.Background()
+
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	t.Run("headers, user agent and request id", func(t *testing.T) {
+		client := NewClient(ctx, WithMiddleware(
+			HeadersMiddleware(http.Header{"x-api-version": {"2"}, "X-Tags": {"a", "b"}}),
+			UserAgentMiddleware("gohans-test/1.0"),
+			RequestIDMiddleware(""),
+		))
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "2", got.Get("X-Api-Version"))
+		assert.Equal(t, []string{"a", "b"}, got.Values("X-Tags"))
+		assert.Equal(t, "gohans-test/1.0", got.Get("User-Agent"))
+		assert.Len(t, got.Get(RequestIDHeader), 32)
+
+		first := got.Get(RequestIDHeader)
+		_, err = NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.NoError(t, err)
+		assert.NotEqual(t, first, got.Get(RequestIDHeader))
+	})
+
+	t.Run("request id is kept when present", func(t *testing.T) {
+		client := NewClient(ctx, WithMiddleware(
+			HeadersMiddleware(http.Header{"X-Correlation-Id": {"fixed"}}),
+			RequestIDMiddleware("X-Correlation-Id"),
+		))
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.NoError(t, err)
+		assert.Equal(t, "fixed", got.Get("X-Correlation-Id"))
+	})
+}
@@ -0,0 +1,163 @@
+package gohans
+
+import (
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// multipartPart is a part of a multipart/form-data body, either a value or a streamed body
+type multipartPart struct {
+	header textproto.MIMEHeader
+	value  string
+	body   *bodyReader
+}
+
+// multipartBody streams a multipart form through a pipe
+// Parts are written by a goroutine started on the first read, so a body that is never read leaks nothing
+type multipartBody struct {
+	once    sync.Once
+	done    chan struct{}
+	parts   []multipartPart
+	readers []io.Reader
+	pr      *io.PipeReader
+	pw      *io.PipeWriter
+	writer  *multipart.Writer
+
+	// resent is the last body returned by getBody, closed before the parts are rewound again
+	mu     sync.Mutex
+	resent *multipartBody
+}
+
+// newMultipartBody positions the readers of the parts at their start and returns the body streaming them
+// A non empty boundary is reused, so a body can be recreated for an already sent Content-Type
+func newMultipartBody(parts []multipartPart, boundary string) (*multipartBody, error) {
+	readers := make([]io.Reader, len(parts))
+	for i, part := range parts {
+		if part.body == nil {
+			continue
+		}
+
+		r, err := part.body.reader()
+		if err != nil {
+			return nil, err
+		}
+
+		readers[i] = r
+	}
+
+	pr, pw := io.Pipe()
+
+	b := &multipartBody{
+		done:    make(chan struct{}),
+		parts:   parts,
+		readers: readers,
+		pr:      pr,
+		pw:      pw,
+		writer:  multipart.NewWriter(pw),
+	}
+
+	if boundary != "" {
+		if err := b.writer.SetBoundary(boundary); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// ContentType returns the multipart/form-data content type including the boundary
+func (b *multipartBody) ContentType() string {
+	return b.writer.FormDataContentType()
+}
+
+// getBody returns a new body streaming the same parts, used by the http client to resend the body on redirects
+// The previous body is closed first, so its writer no longer reads the parts being rewound
+func (b *multipartBody) getBody() (io.ReadCloser, error) {
+	b.release()
+
+	next, err := newMultipartBody(b.parts, b.writer.Boundary())
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.resent = next
+	b.mu.Unlock()
+
+	return next, nil
+}
+
+// release closes the body and the last one returned by getBody
+func (b *multipartBody) release() {
+	b.Close()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.resent != nil {
+		b.resent.Close()
+	}
+}
+
+func (b *multipartBody) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		go func() {
+			b.pw.CloseWithError(b.write())
+			close(b.done)
+		}()
+	})
+
+	return b.pr.Read(p)
+}
+
+// Close closes the pipe and waits for the writer goroutine to stop reading the parts
+func (b *multipartBody) Close() error {
+	err := b.pr.Close()
+
+	// A body that was never read has no writer to wait for
+	b.once.Do(func() { close(b.done) })
+	<-b.done
+
+	return err
+}
+
+func (b *multipartBody) write() error {
+	for i, part := range b.parts {
+		w, err := b.writer.CreatePart(part.header)
+		if err != nil {
+			return err
+		}
+
+		if b.readers[i] == nil {
+			_, err = io.WriteString(w, part.value)
+		} else {
+			_, err = io.Copy(w, b.readers[i])
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.writer.Close()
+}
+
+// multipartRewindable reports whether all the streamed parts can be sent again
+func multipartRewindable(parts []multipartPart) bool {
+	for _, part := range parts {
+		if part.body != nil && !part.body.rewindable() {
+			return false
+		}
+	}
+
+	return true
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,128 @@
+package gohans
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func Test_multipartBody(t *testing.T) {
+	t.Run("write parts", func(t *testing.T) {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="meta"`)
+		h.Set("Content-Type", JSONContentType)
+
+		parts := NewRequest().
+			AddFormField("title", "report").
+			AddFile("file", "report.csv", strings.NewReader("a,b\n1,2\n")).
+			AddPart(h, strings.NewReader(`{"k":"v"}`)).
+			multipart
+
+		body, err := newMultipartBody(parts, "")
+		assert.NoError(t, err)
+
+		mt, params, err := mime.ParseMediaType(body.ContentType())
+		assert.NoError(t, err)
+		assert.Equal(t, MultipartContentType, mt)
+
+		mr := multipart.NewReader(body, params["boundary"])
+
+		p, err := mr.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, "title", p.FormName())
+		b, _ := io.ReadAll(p)
+		assert.Equal(t, "report", string(b))
+
+		p, err = mr.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, "file", p.FormName())
+		assert.Equal(t, "report.csv", p.FileName())
+		assert.Equal(t, "text/csv; charset=utf-8", p.Header.Get("Content-Type"))
+		b, _ = io.ReadAll(p)
+		assert.Equal(t, "a,b\n1,2\n", string(b))
+
+		p, err = mr.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, "meta", p.FormName())
+		assert.Equal(t, JSONContentType, p.Header.Get("Content-Type"))
+		b, _ = io.ReadAll(p)
+		assert.Equal(t, `{"k":"v"}`, string(b))
+
+		_, err = mr.NextPart()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("reader error", func(t *testing.T) {
+		body, err := newMultipartBody(NewRequest().AddFile("file", "data.bin", failingReader{}).multipart, "")
+		assert.NoError(t, err)
+
+		_, err = io.ReadAll(body)
+		assert.EqualError(t, err, "read failed")
+	})
+
+	t.Run("close before read", func(t *testing.T) {
+		body, err := newMultipartBody(NewRequest().AddFormField("a", "b").multipart, "")
+		assert.NoError(t, err)
+
+		assert.NoError(t, body.Close())
+		_, err = body.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+	})
+
+	t.Run("close waits for the writer", func(t *testing.T) {
+		body, err := newMultipartBody(NewRequest().AddFile("file", "a.bin", bytes.NewReader(make([]byte, 1<<20))).multipart, "")
+		assert.NoError(t, err)
+
+		_, err = body.Read(make([]byte, 1))
+		assert.NoError(t, err)
+
+		assert.NoError(t, body.Close())
+
+		select {
+		case <-body.done:
+		default:
+			t.Fatal("writer still running after Close")
+		}
+	})
+
+	t.Run("get body rewinds parts", func(t *testing.T) {
+		body, err := newMultipartBody(NewRequest().AddFile("file", "a.txt", strings.NewReader("content")).multipart, "")
+		assert.NoError(t, err)
+
+		first, err := io.ReadAll(body)
+		assert.NoError(t, err)
+
+		again, err := body.getBody()
+		assert.NoError(t, err)
+
+		second, err := io.ReadAll(again)
+		assert.NoError(t, err)
+		assert.Equal(t, string(first), string(second))
+	})
+
+	t.Run("get body of a non seekable part", func(t *testing.T) {
+		body, err := newMultipartBody(NewRequest().AddFile("file", "a.bin", io.LimitReader(zeroReader{}, 4)).multipart, "")
+		assert.NoError(t, err)
+
+		_, err = io.ReadAll(body)
+		assert.NoError(t, err)
+
+		_, err = body.getBody()
+		assert.ErrorIs(t, err, BodyNotRewindableError)
+	})
+}
+
+func Test_escapeQuotes(t *testing.T) {
+	assert.Equal(t, `my \"file\"\\name`, escapeQuotes(`my "file"\name`))
+}
@@ -0,0 +1,168 @@
+package gohans
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+)
+
+const (
+	NDJSONContentType = "application/x-ndjson"
+
+	// DefaultMaxLineSize is the longest line accepted in a JSON lines body unless set with SetMaxLineSize
+	DefaultMaxLineSize = 1 << 20
+)
+
+var LineTooLongError = errors.New("line too long")
+
+// LineError reports a line of a JSON lines body that could not be read or decoded
+type LineError struct {
+	// Line is the 1-based line number in the body
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeLines sends the request and decodes a newline delimited JSON body record by record into T,
+// without buffering the whole body
+// A line that cannot be decoded, or is longer than the maximum line size, is yielded as a *LineError
+// and the iteration goes on with the next line. Other errors end the iteration
+// Blank lines are skipped, and Accept is set to application/x-ndjson unless another type was set
+func DecodeLines[T any](ctx context.Context, c *Client, r *Request) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		if accept := r.Headers.Get("Accept"); accept == "" || accept == JSONContentType {
+			r.SetHeader("Accept", NDJSONContentType)
+		}
+
+		codec, ok := c.codecs.lookup(JSONContentType)
+		if !ok {
+			codec = JSONCodec{}
+		}
+
+		resp, err := c.stream(ctx, r)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		maxLineSize := r.maxLineSize
+		if maxLineSize <= 0 {
+			maxLineSize = DefaultMaxLineSize
+		}
+
+		lr := newLineReader(resp.Body, maxLineSize)
+		for {
+			line, err := lr.next()
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil && !errors.Is(err, LineTooLongError) {
+				yield(zero, err)
+				return
+			}
+
+			if err == nil {
+				var v T
+				if err = codec.Decode(bytes.NewReader(line), &v); err == nil {
+					if !yield(v, nil) {
+						return
+					}
+
+					continue
+				}
+			}
+
+			if !yield(zero, &LineError{Line: lr.line, Err: err}) {
+				return
+			}
+		}
+	}
+}
+
+// EachLine sends the request and calls fn with each record of a newline delimited JSON body
+// It stops at the first error, including a *LineError or an error returned by fn
+func EachLine[T any](ctx context.Context, c *Client, r *Request, fn func(T) error) error {
+	for v, err := range DecodeLines[T](ctx, c, r) {
+		if err != nil {
+			return err
+		}
+
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lineReader reads lines of at most max bytes, skipping blank lines
+type lineReader struct {
+	r   *bufio.Reader
+	max int
+	buf []byte
+	// line is the number of the last line read
+	line int
+}
+
+func newLineReader(r io.Reader, max int) *lineReader {
+	return &lineReader{r: bufio.NewReader(r), max: max}
+}
+
+// next returns the next non blank line without its line ending
+// A line longer than max is skipped and reported with LineTooLongError, so reading can go on
+func (lr *lineReader) next() ([]byte, error) {
+	for {
+		lr.buf = lr.buf[:0]
+		tooLong := false
+
+		for {
+			chunk, err := lr.r.ReadSlice('\n')
+			if !tooLong {
+				lr.buf = append(lr.buf, chunk...)
+				if len(bytes.TrimRight(lr.buf, "\r\n")) > lr.max {
+					tooLong = true
+					lr.buf = lr.buf[:0]
+				}
+			}
+
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+
+			if err == io.EOF && (len(lr.buf) > 0 || tooLong) {
+				break
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			break
+		}
+
+		lr.line++
+
+		if tooLong {
+			return nil, LineTooLongError
+		}
+
+		if line := bytes.TrimSpace(lr.buf); len(line) > 0 {
+			return line, nil
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package gohans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_lineReader(t *testing.T) {
+	body := "{\"a\":1}\r\n\n   \n" + strings.Repeat("x", 40) + "\n{\"a\":2}\n{\"a\":3}"
+	lr := newLineReader(strings.NewReader(body), 16)
+
+	var lines []string
+	var numbers []int
+	for {
+		line, err := lr.next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			assert.ErrorIs(t, err, LineTooLongError)
+			line = []byte("too long")
+		}
+
+		lines = append(lines, string(line))
+		numbers = append(numbers, lr.line)
+	}
+
+	assert.Equal(t, []string{`{"a":1}`, "too long", `{"a":2}`, `{"a":3}`}, lines)
+	assert.Equal(t, []int{1, 4, 5, 6}, numbers)
+}
+
+func TestDecodeLines(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+
+	type record struct {
+		ID int `json:"id"`
+	}
+
+	t.Run("decode records", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, NDJSONContentType, r.Header.Get("Accept"))
+
+			w.Header().Set("Content-Type", NDJSONContentType)
+			for i := 1; i <= 1000; i++ {
+				fmt.Fprintf(w, "{\"id\": %d}\n", i)
+			}
+		}))
+		defer server.Close()
+
+		var ids []int
+		for rec, err := range DecodeLines[record](ctx, client, NewRequest().SetURL(server.URL)) {
+			assert.NoError(t, err)
+			ids = append(ids, rec.ID)
+		}
+
+		assert.Len(t, ids, 1000)
+		assert.Equal(t, 1000, ids[999])
+	})
+
+	t.Run("line errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "{\"id\": 1}\nnot json\n{\"id\": \""+strings.Repeat("9", 64)+"\"}\n{\"id\": 4}\n")
+		}))
+		defer server.Close()
+
+		var ids []int
+		var lineErrs []*LineError
+		for rec, err := range DecodeLines[record](ctx, client, NewRequest().SetURL(server.URL).SetMaxLineSize(32)) {
+			var lineErr *LineError
+			if errors.As(err, &lineErr) {
+				lineErrs = append(lineErrs, lineErr)
+				continue
+			}
+
+			assert.NoError(t, err)
+			ids = append(ids, rec.ID)
+		}
+
+		assert.Equal(t, []int{1, 4}, ids)
+		assert.Len(t, lineErrs, 2)
+		assert.Equal(t, 2, lineErrs[0].Line)
+		assert.Equal(t, 3, lineErrs[1].Line)
+		assert.ErrorIs(t, lineErrs[1], LineTooLongError)
+		assert.EqualError(t, lineErrs[1], "line 3: line too long")
+	})
+
+	t.Run("unexpected status code", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", JSONContentType)
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "forbidden"}`))
+		}))
+		defer server.Close()
+
+		errBody := &Error{}
+
+		var errs []error
+		for _, err := range DecodeLines[record](ctx, client, NewRequest().SetURL(server.URL).SetErrorResponseBody(errBody)) {
+			errs = append(errs, err)
+		}
+
+		assert.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], UnexpectedStatusCodeError)
+		assert.Equal(t, "forbidden", errBody.Error)
+	})
+
+	t.Run("stop iteration", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "{\"id\": 1}\n{\"id\": 2}\n")
+		}))
+		defer server.Close()
+
+		var count int
+		for range DecodeLines[record](ctx, client, NewRequest().SetURL(server.URL)) {
+			count++
+			break
+		}
+
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestEachLine(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{\"id\": 1}\n{\"id\": 2}\nbad\n{\"id\": 4}\n")
+	}))
+	defer server.Close()
+
+	type record struct {
+		ID int `json:"id"`
+	}
+
+	t.Run("stops at line error", func(t *testing.T) {
+		var ids []int
+		err := EachLine(ctx, client, NewRequest().SetURL(server.URL), func(rec record) error {
+			ids = append(ids, rec.ID)
+			return nil
+		})
+
+		var lineErr *LineError
+		assert.ErrorAs(t, err, &lineErr)
+		assert.Equal(t, 3, lineErr.Line)
+		assert.Equal(t, []int{1, 2}, ids)
+	})
+
+	t.Run("stops at callback error", func(t *testing.T) {
+		stop := errors.New("stop")
+
+		err := EachLine(ctx, client, NewRequest().SetURL(server.URL), func(rec record) error {
+			return stop
+		})
+
+		assert.Equal(t, stop, err)
+	})
+}
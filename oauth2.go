@@ -0,0 +1,281 @@
+package gohans
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultExpiryMargin is how long before its expiry a cached token is renewed unless set in OAuth2Config
+const DefaultExpiryMargin = 30 * time.Second
+
+// OAuth2Config configures how OAuth2 tokens are fetched from a token endpoint
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Params are extra form parameters sent to the token endpoint, e.g. audience
+	Params url.Values
+	// AuthInParams sends the client credentials as form parameters instead of HTTP Basic authentication
+	AuthInParams bool
+	// ExpiryMargin renews a token this long before it expires, DefaultExpiryMargin when zero
+	// Tokens are used for at least half their lifetime whatever the margin
+	ExpiryMargin time.Duration
+	// HTTPClient sends the token requests, a client with a 30 second timeout when nil
+	HTTPClient *http.Client
+}
+
+// Token is an OAuth2 access token
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	// Expiry is zero when the token endpoint did not send an expiry
+	Expiry time.Time
+
+	// lifetime is the expires_in of the token response
+	lifetime time.Duration
+}
+
+// valid reports whether the token can be used until at least margin from now
+// The margin is capped at half the token lifetime, so short lived tokens are still reused
+func (t *Token) valid(now time.Time, margin time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+
+	if t.Expiry.IsZero() {
+		return true
+	}
+
+	if t.lifetime > 0 {
+		margin = min(margin, t.lifetime/2)
+	}
+
+	return now.Add(margin).Before(t.Expiry)
+}
+
+// TokenError is an error response of a token endpoint, as defined by RFC 6749 section 5.2
+type TokenError struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *TokenError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth2: %s: %s (status code %d)", e.Code, e.Description, e.StatusCode)
+	}
+
+	return fmt.Sprintf("oauth2: %s (status code %d)", e.Code, e.StatusCode)
+}
+
+// OAuth2 authenticates requests with bearer tokens fetched from a token endpoint
+// Tokens are cached until shortly before they expire, and concurrent requests share a single token fetch
+type OAuth2 struct {
+	config OAuth2Config
+	client *Client
+	grant  string
+
+	mu           sync.Mutex
+	token        *Token
+	refreshToken string
+	fetching     *tokenFetch
+}
+
+// tokenFetch is a token request shared by the callers waiting for it
+type tokenFetch struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// ClientCredentials returns an authenticator using the OAuth2 client credentials grant
+func ClientCredentials(config OAuth2Config) *OAuth2 {
+	return newOAuth2(config, "client_credentials", "")
+}
+
+// RefreshToken returns an authenticator using the OAuth2 refresh token grant
+// The refresh token is replaced when the token endpoint rotates it
+func RefreshToken(config OAuth2Config, refreshToken string) *OAuth2 {
+	return newOAuth2(config, "refresh_token", refreshToken)
+}
+
+func newOAuth2(config OAuth2Config, grant, refreshToken string) *OAuth2 {
+	if config.ExpiryMargin == 0 {
+		config.ExpiryMargin = DefaultExpiryMargin
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &OAuth2{
+		config:       config,
+		client:       NewClient(context.Background(), WithHTTPClient(httpClient)),
+		grant:        grant,
+		refreshToken: refreshToken,
+	}
+}
+
+// Authenticate sets a bearer token on the request, fetching a new one if the cached token expired
+func (o *OAuth2) Authenticate(req *http.Request) error {
+	t, err := o.Token(req.Context())
+	if err != nil {
+		return err
+	}
+
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+
+	req.Header.Set("Authorization", tokenType+" "+t.AccessToken)
+
+	return nil
+}
+
+// Challenge discards the cached token if the server rejected it, so the retry fetches a new one
+func (o *OAuth2) Challenge(resp *http.Response) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Another request may already have replaced the rejected token
+	if o.token != nil && (resp.Request == nil || strings.HasSuffix(resp.Request.Header.Get("Authorization"), " "+o.token.AccessToken)) {
+		o.token = nil
+	}
+
+	return true
+}
+
+// Token returns the cached token, or fetches a new one when it is missing or about to expire
+func (o *OAuth2) Token(ctx context.Context) (*Token, error) {
+	o.mu.Lock()
+	if o.token.valid(time.Now(), o.config.ExpiryMargin) {
+		t := o.token
+		o.mu.Unlock()
+
+		return t, nil
+	}
+
+	f := o.fetching
+	if f == nil {
+		f = &tokenFetch{done: make(chan struct{})}
+		o.fetching = f
+
+		// The fetch is shared, so it is not canceled with the context of the request starting it
+		go o.fetch(context.WithoutCancel(ctx), f)
+	}
+	o.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (o *OAuth2) fetch(ctx context.Context, f *tokenFetch) {
+	defer close(f.done)
+
+	o.mu.Lock()
+	refreshToken := o.refreshToken
+	o.mu.Unlock()
+
+	f.token, f.err = o.requestToken(ctx, refreshToken)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.fetching = nil
+	if f.err != nil {
+		return
+	}
+
+	o.token = f.token
+	if f.token.RefreshToken != "" {
+		o.refreshToken = f.token.RefreshToken
+	}
+}
+
+// tokenResponse is a successful token endpoint response, as defined by RFC 6749 section 5.1
+type tokenResponse struct {
+	AccessToken  string      `json:"access_token"`
+	TokenType    string      `json:"token_type"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    json.Number `json:"expires_in"`
+}
+
+func (o *OAuth2) requestToken(ctx context.Context, refreshToken string) (*Token, error) {
+	form := url.Values{"grant_type": {o.grant}}
+	for k, v := range o.config.Params {
+		form[k] = v
+	}
+
+	if len(o.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.config.Scopes, " "))
+	}
+
+	if o.grant == "refresh_token" {
+		form.Set("refresh_token", refreshToken)
+	}
+
+	if o.config.AuthInParams {
+		form.Set("client_id", o.config.ClientID)
+		form.Set("client_secret", o.config.ClientSecret)
+	}
+
+	r := NewRequest().
+		SetMethod(http.MethodPost).
+		SetURL(o.config.TokenURL).
+		SetFormBody(form).
+		SetHeader("Accept", JSONContentType)
+
+	if !o.config.AuthInParams {
+		// RFC 6749 section 2.3.1 form encodes the credentials before using them for Basic authentication
+		req := http.Request{Header: http.Header{}}
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret))
+		r.SetHeader("Authorization", req.Header.Get("Authorization"))
+	}
+
+	var body tokenResponse
+	tokenErr := &TokenError{}
+
+	start := time.Now()
+	_, err := r.SetWantedResponseBody(&body).SetErrorResponseBody(tokenErr).Send(ctx, o.client)
+	if err != nil {
+		if tokenErr.Code != "" {
+			tokenErr.StatusCode = r.GetStatusCode()
+			return nil, tokenErr
+		}
+
+		return nil, fmt.Errorf("oauth2: cannot fetch token: %w", err)
+	}
+
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2: token response has no access_token")
+	}
+
+	t := &Token{AccessToken: body.AccessToken, TokenType: body.TokenType, RefreshToken: body.RefreshToken}
+	if body.ExpiresIn != "" {
+		seconds, err := body.ExpiresIn.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("oauth2: invalid expires_in %q", body.ExpiresIn)
+		}
+
+		if seconds > 0 {
+			t.lifetime = time.Duration(seconds * float64(time.Second))
+			t.Expiry = start.Add(t.lifetime)
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,252 @@
+package gohans
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenServer issues numbered access tokens, refusing unknown clients
+type tokenServer struct {
+	*httptest.Server
+	issued    atomic.Int32
+	expiresIn int
+	forms     chan url.Values
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	s := &tokenServer{expiresIn: expiresIn, forms: make(chan url.Values, 100)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, r.ParseForm())
+
+		id, secret := r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		if user, pass, ok := r.BasicAuth(); ok {
+			id, _ = url.QueryUnescape(user)
+			secret, _ = url.QueryUnescape(pass)
+		}
+
+		s.forms <- r.PostForm
+		w.Header().Set("Content-Type", JSONContentType)
+
+		if id != "client" || secret != "s3cr:t" || r.PostForm.Get("refresh_token") == "revoked" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_client", "error_description": "unknown client"}`))
+			return
+		}
+
+		// Let concurrent callers pile up on the same fetch
+		time.Sleep(20 * time.Millisecond)
+
+		n := s.issued.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  fmt.Sprintf("token-%d", n),
+			"token_type":    "bearer",
+			"expires_in":    s.expiresIn,
+			"refresh_token": fmt.Sprintf("refresh-%d", n),
+		})
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestToken_valid(t *testing.T) {
+	now := time.Now()
+	hour := &Token{AccessToken: "a", Expiry: now.Add(time.Hour), lifetime: time.Hour}
+
+	assert.True(t, hour.valid(now, time.Minute))
+	assert.False(t, hour.valid(now.Add(59*time.Minute), time.Minute))
+
+	// The margin is capped at half the lifetime of short lived tokens
+	short := &Token{AccessToken: "a", Expiry: now.Add(20 * time.Second), lifetime: 20 * time.Second}
+	assert.True(t, short.valid(now, DefaultExpiryMargin))
+	assert.True(t, short.valid(now.Add(9*time.Second), DefaultExpiryMargin))
+	assert.False(t, short.valid(now.Add(10*time.Second), DefaultExpiryMargin))
+
+	assert.True(t, (&Token{AccessToken: "a"}).valid(now, time.Minute))
+	assert.False(t, (&Token{}).valid(now, time.Minute))
+	assert.False(t, (*Token)(nil).valid(now, time.Minute))
+}
+
+func TestClientCredentials(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("single flight", func(t *testing.T) {
+		ts := newTokenServer(t, 3600)
+		auth := ClientCredentials(OAuth2Config{TokenURL: ts.URL, ClientID: "client", ClientSecret: "s3cr:t", Scopes: []string{"read", "write"}})
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				token, err := auth.Token(ctx)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "token-1", token.AccessToken)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), ts.issued.Load())
+
+		form := <-ts.forms
+		assert.Equal(t, "client_credentials", form.Get("grant_type"))
+		assert.Equal(t, "read write", form.Get("scope"))
+		assert.Empty(t, form.Get("client_secret"))
+	})
+
+	t.Run("credentials in params", func(t *testing.T) {
+		ts := newTokenServer(t, 3600)
+		auth := ClientCredentials(OAuth2Config{
+			TokenURL: ts.URL, ClientID: "client", ClientSecret: "s3cr:t", AuthInParams: true,
+			Params: url.Values{"audience": {"api"}},
+		})
+
+		_, err := auth.Token(ctx)
+		assert.NoError(t, err)
+
+		form := <-ts.forms
+		assert.Equal(t, "client", form.Get("client_id"))
+		assert.Equal(t, "api", form.Get("audience"))
+	})
+
+	t.Run("short lived token", func(t *testing.T) {
+		// The default margin is longer than the token lifetime
+		ts := newTokenServer(t, 20)
+		auth := ClientCredentials(OAuth2Config{TokenURL: ts.URL, ClientID: "client", ClientSecret: "s3cr:t"})
+
+		for range 3 {
+			token, err := auth.Token(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, "token-1", token.AccessToken)
+		}
+
+		assert.Equal(t, int32(1), ts.issued.Load())
+	})
+
+	t.Run("token endpoint error", func(t *testing.T) {
+		ts := newTokenServer(t, 3600)
+		auth := ClientCredentials(OAuth2Config{TokenURL: ts.URL, ClientID: "client", ClientSecret: "wrong"})
+
+		_, err := auth.Token(ctx)
+
+		var tokenErr *TokenError
+		assert.ErrorAs(t, err, &tokenErr)
+		assert.Equal(t, http.StatusBadRequest, tokenErr.StatusCode)
+		assert.Equal(t, "invalid_client", tokenErr.Code)
+		assert.Equal(t, "oauth2: invalid_client: unknown client (status code 400)", err.Error())
+
+		// Errors are not cached
+		auth.config.ClientSecret = "s3cr:t"
+		_, err = auth.Token(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("canceled caller", func(t *testing.T) {
+		ts := newTokenServer(t, 3600)
+		auth := ClientCredentials(OAuth2Config{TokenURL: ts.URL, ClientID: "client", ClientSecret: "s3cr:t"})
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := auth.Token(cctx)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		// The fetch carries on for the next caller
+		token, err := auth.Token(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "token-1", token.AccessToken)
+	})
+}
+
+func TestClientCredentials_withClient(t *testing.T) {
+	ctx := context.Background()
+	ts := newTokenServer(t, 3600)
+
+	var revoked atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token-1" && revoked.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	auth := ClientCredentials(OAuth2Config{TokenURL: ts.URL, ClientID: "client", ClientSecret: "s3cr:t"})
+	client := NewClient(ctx, WithAuthenticator(auth))
+
+	_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+	assert.NoError(t, err)
+
+	// A revoked token is replaced and the request sent again
+	revoked.Store(true)
+
+	_, err = NewRequest().SetURL(server.URL).Send(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), ts.issued.Load())
+
+	token, err := auth.Token(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken)
+}
+
+func TestRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	ts := newTokenServer(t, 0)
+
+	auth := RefreshToken(OAuth2Config{TokenURL: ts.URL, ClientID: "client", ClientSecret: "s3cr:t"}, "initial")
+
+	token, err := auth.Token(ctx)
+	assert.NoError(t, err)
+	assert.True(t, token.Expiry.IsZero())
+
+	form := <-ts.forms
+	assert.Equal(t, "refresh_token", form.Get("grant_type"))
+	assert.Equal(t, "initial", form.Get("refresh_token"))
+
+	// The rotated refresh token is used for the next fetch
+	auth.Challenge(&http.Response{})
+
+	_, err = auth.Token(ctx)
+	assert.NoError(t, err)
+
+	form = <-ts.forms
+	assert.Equal(t, "refresh-1", form.Get("refresh_token"))
+
+	t.Run("revoked", func(t *testing.T) {
+		auth := RefreshToken(OAuth2Config{TokenURL: ts.URL, ClientID: "client", ClientSecret: "s3cr:t"}, "revoked")
+
+		_, err := auth.Token(ctx)
+		assert.ErrorContains(t, err, "invalid_client")
+	})
+}
+
+func TestOAuth2_Challenge(t *testing.T) {
+	auth := ClientCredentials(OAuth2Config{})
+	auth.token = &Token{AccessToken: "current"}
+
+	// A token replaced since the request was sent is kept
+	stale := &http.Request{Header: http.Header{"Authorization": {"Bearer previous"}}}
+	assert.True(t, auth.Challenge(&http.Response{Request: stale}))
+	assert.NotNil(t, auth.token)
+
+	current := &http.Request{Header: http.Header{"Authorization": {"Bearer current"}}}
+	assert.True(t, auth.Challenge(&http.Response{Request: current}))
+	assert.Nil(t, auth.token)
+}
@@ -0,0 +1,261 @@
+package gohans
+
+import (
+	"context"
+	"iter"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PageStrategy moves a request from one page to the next
+type PageStrategy interface {
+	// Start prepares the request of the first page
+	Start(r *Request)
+	// Next prepares the request of the page following the decoded page with the given number of items
+	// It reports false after the last page
+	Next(r *Request, res *Response, page any, items int) bool
+}
+
+// Paginator follows the pages of a request and iterates over their items
+// P is the type a page body is decoded into, and T the type of its items
+type Paginator[P, T any] struct {
+	Strategy PageStrategy
+	// Items returns the items of a decoded page
+	Items func(page P) []T
+	// MaxPages stops the iteration after this many pages, zero for no limit
+	MaxPages int
+}
+
+// Paginate follows the pages of a request whose body is a list of items, e.g. with LinkHeader
+func Paginate[T any](ctx context.Context, c RequestClient, r *Request, strategy PageStrategy) iter.Seq2[T, error] {
+	return Paginator[[]T, T]{
+		Strategy: strategy,
+		Items:    func(page []T) []T { return page },
+	}.All(ctx, c, r)
+}
+
+// All sends the request for each page and returns an iterator over the items of all the pages
+// Pages are requested lazily, as items are consumed. A failed page or a canceled context yields
+// the error and ends the iteration
+// The request is modified by the strategy as pages are followed
+func (p Paginator[P, T]) All(ctx context.Context, c RequestClient, r *Request) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		p.Strategy.Start(r)
+
+		for pages := 1; ; pages++ {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			var page P
+
+			res, err := r.SetWantedResponseBody(&page).Do(ctx, c)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+
+			items := p.Items(page)
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if p.MaxPages > 0 && pages >= p.MaxPages {
+				return
+			}
+
+			if !p.Strategy.Next(r, res, page, len(items)) {
+				return
+			}
+		}
+	}
+}
+
+// LinkHeader follows the rel="next" URL of the RFC 8288 Link response header, as sent by GitHub
+func LinkHeader() PageStrategy {
+	return linkHeader{}
+}
+
+type linkHeader struct{}
+
+func (linkHeader) Start(*Request) {}
+
+func (linkHeader) Next(r *Request, res *Response, _ any, _ int) bool {
+	next, ok := parseLinkHeader(res.Header.Values("Link"))["next"]
+	if !ok {
+		return false
+	}
+
+	u, err := url.Parse(next)
+	if err != nil {
+		return false
+	}
+
+	if res.URL != nil {
+		u = res.URL.ResolveReference(u)
+	}
+
+	// A next link pointing to the current page would never end
+	if res.URL != nil && u.String() == res.URL.String() {
+		return false
+	}
+
+	// The next URL holds the whole query, so the request path and query are dropped
+	r.URL = u.String()
+	r.path = ""
+	r.query = nil
+
+	return true
+}
+
+// Cursor sends the cursor returned by the next function as the param query parameter
+// The iteration ends when the cursor is empty
+func Cursor[P any](param string, next func(page P) string) PageStrategy {
+	return cursor[P]{param: param, next: next}
+}
+
+type cursor[P any] struct {
+	param string
+	next  func(page P) string
+}
+
+func (c cursor[P]) Start(*Request) {}
+
+func (c cursor[P]) Next(r *Request, _ *Response, page any, _ int) bool {
+	p, ok := page.(P)
+	if !ok {
+		return false
+	}
+
+	next := c.next(p)
+	if next == "" {
+		return false
+	}
+
+	r.SetQueryParam(c.param, next)
+
+	return true
+}
+
+// OffsetLimit pages with offset and limit query parameters
+// The first page starts at the offset already set on the request, or 0, and a page with less than limit items is the last
+func OffsetLimit(offsetParam, limitParam string, limit int) PageStrategy {
+	return offsetLimit{offset: offsetParam, limit: limitParam, size: limit}
+}
+
+type offsetLimit struct {
+	offset, limit string
+	size          int
+}
+
+func (o offsetLimit) Start(r *Request) {
+	r.SetQueryParam(o.limit, strconv.Itoa(o.size))
+	if r.query.Get(o.offset) == "" {
+		r.SetQueryParam(o.offset, "0")
+	}
+}
+
+func (o offsetLimit) Next(r *Request, _ *Response, _ any, items int) bool {
+	if items == 0 || items < o.size {
+		return false
+	}
+
+	offset, _ := strconv.Atoi(r.query.Get(o.offset))
+	r.SetQueryParam(o.offset, strconv.Itoa(offset+items))
+
+	return true
+}
+
+// PageNumber pages with a page number query parameter, starting at first unless already set on the request
+// A page without items is the last
+func PageNumber(param string, first int) PageStrategy {
+	return pageNumber{param: param, first: first}
+}
+
+type pageNumber struct {
+	param string
+	first int
+}
+
+func (p pageNumber) Start(r *Request) {
+	if r.query.Get(p.param) == "" {
+		r.SetQueryParam(p.param, strconv.Itoa(p.first))
+	}
+}
+
+func (p pageNumber) Next(r *Request, _ *Response, _ any, items int) bool {
+	if items == 0 {
+		return false
+	}
+
+	page, _ := strconv.Atoi(r.query.Get(p.param))
+	r.SetQueryParam(p.param, strconv.Itoa(page+1))
+
+	return true
+}
+
+// parseLinkHeader returns the URLs of Link header values by relation type
+// A link with several relation types, e.g. rel="next last", is returned for each of them
+func parseLinkHeader(values []string) map[string]string {
+	links := map[string]string{}
+
+	for _, value := range values {
+		for value != "" {
+			start := strings.IndexByte(value, '<')
+			end := strings.IndexByte(value, '>')
+			if start < 0 || end < start {
+				break
+			}
+
+			target := value[start+1 : end]
+			params, rest := splitLinkParams(value[end+1:])
+			value = rest
+
+			for _, param := range params {
+				name, v, _ := strings.Cut(param, "=")
+				if !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(v), `"`)) {
+					rel = strings.ToLower(rel)
+					if _, ok := links[rel]; !ok {
+						links[rel] = target
+					}
+				}
+			}
+		}
+	}
+
+	return links
+}
+
+// splitLinkParams splits the ;-separated parameters of a link up to the comma ending it, ignoring quoted separators
+func splitLinkParams(s string) (params []string, rest string) {
+	var quoted bool
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				params = append(params, s[start:i])
+				start = i + 1
+			}
+		case ',':
+			if !quoted {
+				return append(params, s[start:i]), s[i+1:]
+			}
+		}
+	}
+
+	return append(params, s[start:]), ""
+}
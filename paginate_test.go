@@ -0,0 +1,249 @@
+package gohans
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseLinkHeader(t *testing.T) {
+	links := parseLinkHeader([]string{
+		`<https://api.example.com/items?page=2>; rel="next", <https://api.example.com/items?page=9>; rel="last"`,
+		`<https://api.example.com/items?q=a,b;c>; title="a, b; c"; REL="prev first"`,
+		`garbage`,
+	})
+
+	assert.Equal(t, map[string]string{
+		"next":  "https://api.example.com/items?page=2",
+		"last":  "https://api.example.com/items?page=9",
+		"prev":  "https://api.example.com/items?q=a,b;c",
+		"first": "https://api.example.com/items?q=a,b;c",
+	}, links)
+}
+
+// itemsServer serves the numbers 1 to total, with pages selected by the page function
+func itemsServer(total int, page func(w http.ResponseWriter, r *http.Request) (start, end int)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, end := page(w, r)
+		start, end = max(start, 0), min(end, total)
+
+		items := []int{}
+		for i := start; i < end; i++ {
+			items = append(items, i+1)
+		}
+
+		w.Header().Set("Content-Type", JSONContentType)
+		json.NewEncoder(w).Encode(items)
+	}))
+}
+
+func collect[T any](t *testing.T, seq func(yield func(T, error) bool)) []T {
+	var items []T
+	for item, err := range seq {
+		assert.NoError(t, err)
+		items = append(items, item)
+	}
+
+	return items
+}
+
+func TestPaginate(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+
+	t.Run("link header", func(t *testing.T) {
+		server := itemsServer(7, func(w http.ResponseWriter, r *http.Request) (int, int) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page == 0 {
+				page = 1
+			}
+
+			if page*3 < 7 {
+				w.Header().Set("Link", fmt.Sprintf(`</items?page=%d>; rel="next"`, page+1))
+			}
+
+			return (page - 1) * 3, page * 3
+		})
+		defer server.Close()
+
+		items := collect(t, Paginate[int](ctx, client, NewRequest().SetURL(server.URL).SetPath("/items"), LinkHeader()))
+		assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7}, items)
+	})
+
+	t.Run("link to the same page", func(t *testing.T) {
+		var calls atomic.Int32
+		server := itemsServer(3, func(w http.ResponseWriter, r *http.Request) (int, int) {
+			calls.Add(1)
+			w.Header().Set("Link", `</items>; rel="next"`)
+
+			return 0, 3
+		})
+		defer server.Close()
+
+		items := collect(t, Paginate[int](ctx, client, NewRequest().SetURL(server.URL+"/items"), LinkHeader()))
+		assert.Equal(t, []int{1, 2, 3}, items)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("offset limit", func(t *testing.T) {
+		server := itemsServer(10, func(w http.ResponseWriter, r *http.Request) (int, int) {
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			assert.Equal(t, 4, limit)
+
+			return offset, offset + limit
+		})
+		defer server.Close()
+
+		items := collect(t, Paginate[int](ctx, client, NewRequest().SetURL(server.URL), OffsetLimit("offset", "limit", 4)))
+		assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, items)
+
+		items = collect(t, Paginate[int](ctx, client, NewRequest().SetURL(server.URL).SetQueryParam("offset", "8"), OffsetLimit("offset", "limit", 4)))
+		assert.Equal(t, []int{9, 10}, items)
+	})
+
+	t.Run("page number", func(t *testing.T) {
+		var calls atomic.Int32
+		server := itemsServer(5, func(w http.ResponseWriter, r *http.Request) (int, int) {
+			calls.Add(1)
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+			return (page - 1) * 2, page * 2
+		})
+		defer server.Close()
+
+		items := collect(t, Paginate[int](ctx, client, NewRequest().SetURL(server.URL), PageNumber("page", 1)))
+		assert.Equal(t, []int{1, 2, 3, 4, 5}, items)
+		assert.Equal(t, int32(4), calls.Load())
+	})
+
+	t.Run("stop iteration", func(t *testing.T) {
+		var calls atomic.Int32
+		server := itemsServer(100, func(w http.ResponseWriter, r *http.Request) (int, int) {
+			calls.Add(1)
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+			return page * 10, page*10 + 10
+		})
+		defer server.Close()
+
+		var items []int
+		for item := range Paginate[int](ctx, client, NewRequest().SetURL(server.URL), PageNumber("page", 0)) {
+			items = append(items, item)
+			if len(items) == 15 {
+				break
+			}
+		}
+
+		assert.Len(t, items, 15)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "2" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", JSONContentType)
+			w.Write([]byte(`[1]`))
+		}))
+		defer server.Close()
+
+		var items []int
+		var errs []error
+		for item, err := range Paginate[int](ctx, client, NewRequest().SetURL(server.URL), PageNumber("page", 1)) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			items = append(items, item)
+		}
+
+		assert.Equal(t, []int{1}, items)
+		assert.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], UnexpectedStatusCodeError)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		server := itemsServer(100, func(w http.ResponseWriter, r *http.Request) (int, int) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+			return page * 10, page*10 + 10
+		})
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var count int
+		var errs []error
+		for _, err := range Paginate[int](ctx, client, NewRequest().SetURL(server.URL), PageNumber("page", 0)) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if count++; count == 10 {
+				cancel()
+			}
+		}
+
+		assert.Equal(t, 10, count)
+		assert.Equal(t, []error{context.Canceled}, errs)
+	})
+}
+
+func TestPaginator(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+
+	type page struct {
+		Items []string `json:"items"`
+		Next  string   `json:"next"`
+	}
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		w.Header().Set("Content-Type", JSONContentType)
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			w.Write([]byte(`{"items": ["a", "b"], "next": "c1"}`))
+		case "c1":
+			w.Write([]byte(`{"items": ["c"], "next": "c2"}`))
+		case "c2":
+			w.Write([]byte(`{"items": ["d"]}`))
+		}
+	}))
+	defer server.Close()
+
+	paginator := Paginator[page, string]{
+		Strategy: Cursor("cursor", func(p page) string { return p.Next }),
+		Items:    func(p page) []string { return p.Items },
+	}
+
+	t.Run("cursor", func(t *testing.T) {
+		items := collect(t, paginator.All(ctx, client, NewRequest().SetURL(server.URL)))
+		assert.Equal(t, []string{"a", "b", "c", "d"}, items)
+	})
+
+	t.Run("max pages", func(t *testing.T) {
+		calls.Store(0)
+		paginator.MaxPages = 2
+
+		items := collect(t, paginator.All(ctx, client, NewRequest().SetURL(server.URL)))
+		assert.Equal(t, []string{"a", "b", "c"}, items)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
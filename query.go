@@ -0,0 +1,165 @@
+package gohans
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	timeType          = reflect.TypeFor[time.Time]()
+)
+
+// encodeQueryStruct encodes the exported fields of a struct into url values
+// Fields are named by their `url:"name,omitempty"` tag, or by the field name when untagged
+// A "-" name skips the field, and omitempty skips zero values
+// Nil pointers are skipped, slices and arrays add one value per element,
+// time.Time is formatted as RFC 3339 and embedded structs are flattened
+func encodeQueryStruct(v any) (url.Values, error) {
+	values := url.Values{}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return values, nil
+		}
+
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query: expected a struct, got %T", v)
+	}
+
+	return values, encodeStructFields(values, rv)
+}
+
+func encodeStructFields(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+
+		tag := field.Tag.Get("url")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct && !isScalarStruct(ft) {
+				for fv.Kind() == reflect.Pointer {
+					if fv.IsNil() {
+						break
+					}
+
+					fv = fv.Elem()
+				}
+
+				if fv.Kind() == reflect.Struct {
+					if err := encodeStructFields(values, fv); err != nil {
+						return err
+					}
+				}
+
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if opts == "omitempty" && fv.IsZero() {
+			continue
+		}
+
+		if err := encodeQueryValue(values, name, fv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeQueryValue(values url.Values, name string, fv reflect.Value) error {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+
+		fv = fv.Elem()
+	}
+
+	if (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array) && !fv.Type().Implements(textMarshalerType) {
+		for i := 0; i < fv.Len(); i++ {
+			if err := encodeQueryValue(values, name, fv.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	s, err := formatQueryValue(fv)
+	if err != nil {
+		return fmt.Errorf("query: field %s: %w", name, err)
+	}
+
+	values.Add(name, s)
+
+	return nil
+}
+
+func formatQueryValue(fv reflect.Value) (string, error) {
+	if fv.Type() == timeType {
+		return fv.Interface().(time.Time).Format(time.RFC3339), nil
+	}
+
+	if fv.CanAddr() && !fv.Type().Implements(textMarshalerType) && fv.Addr().Type().Implements(textMarshalerType) {
+		fv = fv.Addr()
+	}
+
+	if fv.Type().Implements(textMarshalerType) {
+		b, err := fv.Interface().(encoding.TextMarshaler).MarshalText()
+
+		return string(b), err
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, 64), nil
+	}
+
+	return "", fmt.Errorf("unsupported type %s", fv.Type())
+}
+
+// isScalarStruct reports whether a struct type is encoded as a single value rather than flattened
+func isScalarStruct(t reflect.Type) bool {
+	return t == timeType || t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
@@ -0,0 +1,108 @@
+package gohans
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pagination struct {
+	Page    int `url:"page"`
+	PerPage int `url:"per_page,omitempty"`
+}
+
+type filter struct {
+	Name string `url:"name"`
+}
+
+type level int
+
+func (l *level) MarshalText() ([]byte, error) {
+	return []byte([]string{"low", "high"}[*l]), nil
+}
+
+type searchQuery struct {
+	pagination
+	*filter
+
+	Query    string    `url:"q"`
+	Tags     []string  `url:"tag"`
+	IDs      [2]int    `url:"id"`
+	Since    time.Time `url:"since,omitempty"`
+	Until    time.Time `url:"until,omitempty"`
+	Limit    *int      `url:"limit"`
+	Offset   *int      `url:"offset"`
+	Active   bool      `url:"active"`
+	Ratio    float64   `url:"ratio,omitempty"`
+	Size     uint8
+	IP       net.IP `url:"ip,omitempty"`
+	Level    level  `url:"level"`
+	Internal string `url:"-"`
+	secret   string
+}
+
+func Test_encodeQueryStruct(t *testing.T) {
+	limit := 10
+	q := &searchQuery{
+		pagination: pagination{Page: 2},
+		filter:     &filter{Name: "hans"},
+		Query:      "get the data",
+		Tags:       []string{"a", "b"},
+		IDs:        [2]int{7, 8},
+		Since:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Limit:      &limit,
+		Active:     true,
+		Ratio:      0.25,
+		Size:       3,
+		IP:         net.ParseIP("127.0.0.1"),
+		Level:      1,
+		Internal:   "skip",
+		secret:     "skip",
+	}
+
+	values, err := encodeQueryStruct(q)
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"page":   {"2"},
+		"name":   {"hans"},
+		"q":      {"get the data"},
+		"tag":    {"a", "b"},
+		"id":     {"7", "8"},
+		"since":  {"2024-01-02T03:04:05Z"},
+		"limit":  {"10"},
+		"active": {"true"},
+		"ratio":  {"0.25"},
+		"Size":   {"3"},
+		"ip":     {"127.0.0.1"},
+		"level":  {"high"},
+	}, values)
+
+	t.Run("nil embedded pointer", func(t *testing.T) {
+		values, err := encodeQueryStruct(searchQuery{Query: "x"})
+		assert.NoError(t, err)
+		assert.Equal(t, "x", values.Get("q"))
+		assert.NotContains(t, values, "name")
+		assert.NotContains(t, values, "limit")
+	})
+
+	t.Run("nil pointer", func(t *testing.T) {
+		values, err := encodeQueryStruct((*searchQuery)(nil))
+		assert.NoError(t, err)
+		assert.Empty(t, values)
+	})
+
+	t.Run("not a struct", func(t *testing.T) {
+		_, err := encodeQueryStruct(map[string]string{"a": "b"})
+		assert.EqualError(t, err, "query: expected a struct, got map[string]string")
+	})
+
+	t.Run("unsupported field", func(t *testing.T) {
+		_, err := encodeQueryStruct(struct {
+			Filter map[string]string `url:"filter"`
+		}{Filter: map[string]string{}})
+		assert.EqualError(t, err, "query: field filter: unsupported type map[string]string")
+	})
+}
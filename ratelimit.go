@@ -0,0 +1,186 @@
+package gohans
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit configures the token bucket pacing the requests sent by a client
+type RateLimit struct {
+	// Rate is the number of requests per second
+	Rate float64
+	// Burst is the number of requests that can be sent at once, 1 when not set
+	Burst int
+	// PerHost keeps a separate bucket for each host
+	PerHost bool
+	// Adaptive slows down to the budget announced by the X-RateLimit-Remaining and X-RateLimit-Reset
+	// response headers, and pauses when it is exhausted, until the reset time
+	Adaptive bool
+}
+
+// WithRateLimit paces the requests of the client with a token bucket
+// Sending a request blocks until a token is available or the request context is done
+// A zero rate removes the limit
+func WithRateLimit(limit RateLimit) RequestOption {
+	return func(c *Client) {
+		if limit.Rate <= 0 {
+			c.rateLimiter = nil
+			return
+		}
+
+		if limit.Burst <= 0 {
+			limit.Burst = 1
+		}
+
+		c.rateLimiter = &rateLimiter{limit: limit, buckets: map[string]*bucket{}}
+	}
+}
+
+// rateLimiter holds the buckets of a client, a single one unless limiting per host
+type rateLimiter struct {
+	limit RateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// wrap waits for a token before sending the request, and adapts the rate to the response headers
+func (l *rateLimiter) wrap(next RoundTripFunc) RoundTripFunc {
+	return func(r *Request, req *http.Request) (*http.Response, error) {
+		b := l.bucket(req.URL.Host)
+		if err := b.wait(req); err != nil {
+			return nil, err
+		}
+
+		resp, err := next(r, req)
+		if err == nil && l.limit.Adaptive {
+			if remaining, reset, ok := rateLimitHeaders(resp.Header, time.Now()); ok {
+				b.adapt(remaining, reset, time.Now())
+			}
+		}
+
+		return resp, err
+	}
+}
+
+func (l *rateLimiter) bucket(host string) *bucket {
+	if !l.limit.PerHost {
+		host = ""
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &bucket{
+			rate:   l.limit.Rate,
+			limit:  l.limit.Rate,
+			burst:  float64(l.limit.Burst),
+			tokens: float64(l.limit.Burst),
+			last:   time.Now(),
+		}
+		l.buckets[host] = b
+	}
+
+	return b
+}
+
+// bucket is a token bucket
+// Tokens can go negative: each waiting request reserves a token and sleeps until it is refilled
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	limit  float64
+	burst  float64
+	tokens float64
+	// last is the time tokens were counted at, it is moved to the reset time while the server budget is exhausted
+	last time.Time
+	// until ends a rate lowered by the server budget, the configured rate is restored afterwards
+	until time.Time
+}
+
+// wait blocks until a token is available, the reservation is given back if the context is done first
+func (b *bucket) wait(req *http.Request) error {
+	d := b.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+
+	if err := sleep(req.Context(), d); err != nil {
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// reserve takes a token and returns how long to wait before using it
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.until.IsZero() && now.After(b.until) {
+		b.rate = b.limit
+		b.until = time.Time{}
+	}
+
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+
+	b.tokens--
+
+	// A paused bucket has no tokens before last, then they are spread at the rate
+	wait := b.last.Sub(now)
+	if b.tokens < 0 {
+		wait += time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+
+	return wait
+}
+
+// adapt lowers the rate to spread the remaining requests until the reset time, or pauses until then
+func (b *bucket) adapt(remaining int, reset, now time.Time) {
+	window := reset.Sub(now)
+	if window <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The bucket refills to its burst when the window resets, the waiters already reserved keep their tokens
+	if remaining <= 0 {
+		b.tokens = math.Min(b.tokens, 0) + b.burst
+		b.last = reset
+
+		return
+	}
+
+	b.rate = math.Min(b.limit, float64(remaining)/window.Seconds())
+	b.until = reset
+}
+
+// rateLimitHeaders returns the remaining requests and reset time of X-RateLimit-Remaining and X-RateLimit-Reset
+// The reset is either a Unix timestamp or a number of seconds from now
+func rateLimitHeaders(header http.Header, now time.Time) (remaining int, reset time.Time, ok bool) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	reset, ok = rateLimitReset(header.Get("X-RateLimit-Reset"), now)
+	if !ok {
+		return 0, time.Time{}, false
+	}
+
+	return remaining, reset, true
+}
@@ -0,0 +1,179 @@
+package gohans
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	ctx := context.Background()
+
+	client := NewClient(ctx, WithRateLimit(RateLimit{Rate: 5}))
+	assert.NotNil(t, client.rateLimiter)
+	assert.Equal(t, 1, client.rateLimiter.limit.Burst)
+
+	client = NewClient(ctx, WithRateLimit(RateLimit{Rate: 5}), WithRateLimit(RateLimit{}))
+	assert.Nil(t, client.rateLimiter)
+}
+
+func Test_bucket(t *testing.T) {
+	now := time.Now()
+
+	t.Run("burst then rate", func(t *testing.T) {
+		b := &bucket{rate: 10, limit: 10, burst: 2, tokens: 2, last: now}
+
+		assert.Zero(t, b.reserve(now))
+		assert.Zero(t, b.reserve(now))
+		assert.Equal(t, 100*time.Millisecond, b.reserve(now))
+		assert.Equal(t, 200*time.Millisecond, b.reserve(now))
+
+		// Refilled tokens never exceed the burst
+		b = &bucket{rate: 10, limit: 10, burst: 2, tokens: 0, last: now}
+		assert.Zero(t, b.reserve(now.Add(time.Hour)))
+		assert.Zero(t, b.reserve(now.Add(time.Hour)))
+		assert.Equal(t, 100*time.Millisecond, b.reserve(now.Add(time.Hour)))
+	})
+
+	t.Run("adapt to remaining budget", func(t *testing.T) {
+		b := &bucket{rate: 10, limit: 10, burst: 1, tokens: 1, last: now}
+
+		b.adapt(5, now.Add(10*time.Second), now)
+		assert.Equal(t, 0.5, b.rate)
+		assert.Zero(t, b.reserve(now))
+		assert.Equal(t, 2*time.Second, b.reserve(now))
+
+		// The configured rate is restored after the reset
+		later := now.Add(11 * time.Second)
+		b.reserve(later)
+		assert.Equal(t, 10.0, b.rate)
+
+		// A budget above the configured rate does not speed up
+		b.adapt(1000, later.Add(time.Second), later)
+		assert.Equal(t, 10.0, b.rate)
+	})
+
+	t.Run("pause when exhausted", func(t *testing.T) {
+		b := &bucket{rate: 10, limit: 10, burst: 5, tokens: 5, last: now}
+
+		b.adapt(0, now.Add(3*time.Second), now)
+		assert.Equal(t, 3*time.Second, b.reserve(now))
+		assert.Zero(t, b.reserve(now.Add(4*time.Second)))
+	})
+
+	t.Run("waiters spread at the rate after a pause", func(t *testing.T) {
+		b := &bucket{rate: 1, limit: 1, burst: 1, tokens: 1, last: now}
+
+		b.adapt(0, now.Add(10*time.Second), now)
+		for i := range 5 {
+			assert.Equal(t, time.Duration(10+i)*time.Second, b.reserve(now))
+		}
+
+		b = &bucket{rate: 1, limit: 1, burst: 2, tokens: 2, last: now}
+		b.adapt(0, now.Add(10*time.Second), now)
+		assert.Equal(t, 10*time.Second, b.reserve(now))
+		assert.Equal(t, 10*time.Second, b.reserve(now))
+		assert.Equal(t, 11*time.Second, b.reserve(now))
+	})
+}
+
+func Test_rateLimitHeaders(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name      string
+		remaining string
+		reset     string
+		want      time.Time
+		ok        bool
+	}{
+		{"delta seconds", "10", "30", now.Add(30 * time.Second), true},
+		{"unix timestamp", "0", "1700000060", now.Add(time.Minute), true},
+		{"fractional delta", "10", "1.5", now.Add(1500 * time.Millisecond), true},
+		{"negative delta", "10", "-5", now, true},
+		{"missing remaining", "", "30", time.Time{}, false},
+		{"invalid reset", "10", "soon", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set("X-RateLimit-Remaining", tt.remaining)
+			h.Set("X-RateLimit-Reset", tt.reset)
+
+			_, reset, ok := rateLimitHeaders(h, now)
+			assert.Equal(t, tt.ok, ok)
+			assert.True(t, tt.want.Equal(reset))
+		})
+	}
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/exhausted" {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "0.3")
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Run("paces requests", func(t *testing.T) {
+		client := NewClient(ctx, WithRateLimit(RateLimit{Rate: 20, Burst: 2}))
+
+		start := time.Now()
+		for range 5 {
+			_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+			assert.NoError(t, err)
+		}
+
+		// 2 requests from the burst, then 3 at 20 per second
+		assert.GreaterOrEqual(t, time.Since(start), 140*time.Millisecond)
+	})
+
+	t.Run("per host", func(t *testing.T) {
+		client := NewClient(ctx, WithRateLimit(RateLimit{Rate: 1, PerHost: true}))
+		other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+		start := time.Now()
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.NoError(t, err)
+		_, err = NewRequest().SetURL(other).Send(ctx, client)
+		assert.NoError(t, err)
+
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("context canceled while waiting", func(t *testing.T) {
+		client := NewClient(ctx, WithRateLimit(RateLimit{Rate: 0.1}))
+
+		_, err := NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		_, err = NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("adaptive pause", func(t *testing.T) {
+		client := NewClient(ctx, WithRateLimit(RateLimit{Rate: 100, Burst: 10, Adaptive: true}))
+
+		_, err := NewRequest().SetURL(server.URL+"/exhausted").Send(ctx, client)
+		assert.NoError(t, err)
+
+		start := time.Now()
+		_, err = NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	})
+}
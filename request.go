@@ -2,19 +2,32 @@ package gohans
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"time"
 )
 
 const (
-	JSONContentType = "application/json"
-	XMLContentType  = "application/xml"
+	JSONContentType      = "application/json"
+	XMLContentType       = "application/xml"
+	TextXMLContentType   = "text/xml"
+	FormContentType      = "application/x-www-form-urlencoded"
+	MultipartContentType = "multipart/form-data"
 )
 
 var (
-	defaultHeaders = map[string]string{
-		"Content-Type": JSONContentType,
-		"Accept":       JSONContentType,
+	// defaultHeaders are copied into every new request
+	defaultHeaders = http.Header{
+		"Content-Type": {JSONContentType},
+		"Accept":       {JSONContentType},
 	}
 )
 
@@ -32,18 +45,42 @@ type RequestClient interface {
 type Request struct {
 	Method  string
 	URL     string
-	Headers map[string]string
+	Headers http.Header
 	Body    any
 
+	// path is a template resolved against URL or the client base URL when the request is sent
+	path       string
+	pathParams map[string]string
+	// query is merged into the query of URL when the request is sent
+	query url.Values
+	// body streams a reader set with SetBodyReader, or Body when it is an io.Reader
+	body *bodyReader
+	// multipart holds the parts of a multipart/form-data body, which replaces Body when set
+	multipart []multipartPart
+	// multipartSent is the multipart body of the last attempt, closed before the parts are rewound for the next one
+	multipartSent *multipartBody
+	// download streams the success response body to a writer or a file when set
+	download *download
+	// hedge sends copies of a slow request when set
+	hedge *hedging
+	// maxLineSize limits the lines of a streamed JSON lines body, DefaultMaxLineSize when zero
+	maxLineSize int
+	// err records an error from a setter, it is returned when the request is sent
+	err error
+	// defaulted holds the headers set by NewRequest that no header setter changed since
+	defaulted map[string]bool
+
 	//
 	retries     int
-	contentType string
+	retryPolicy *RetryPolicy
+	metadata    map[string]any
 
 	// Response and ErrorResponse are used to store the response and error response
 	expectedStatusCode int
 	response           any
 	errorResponse      any
 	statusCode         int
+	responseHeader     http.Header
 }
 
 // NewRequest returns a new Request type with default values
@@ -56,8 +93,8 @@ func NewRequest() *Request {
 		Method:             http.MethodGet,
 		errorResponse:      &Error{},
 		expectedStatusCode: 200,
-		contentType:        JSONContentType,
-		Headers:            defaultHeaders,
+		Headers:            defaultHeaders.Clone(),
+		defaulted:          map[string]bool{"Content-Type": true, "Accept": true},
 	}
 }
 
@@ -70,7 +107,7 @@ func (r *Request) SetMethod(method string) *Request {
 
 // SetAuthToken sets the Authorization header with the token
 func (r *Request) SetAuthToken(token string) *Request {
-	r.Headers["Authorization"] = fmt.Sprintf("Bearer %s", token)
+	r.headers().Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
 	return r
 }
@@ -82,13 +119,171 @@ func (r *Request) SetURL(url string) *Request {
 	return r
 }
 
+// SetPath sets a path template such as "/users/{id}/orders/{orderID}"
+// The path is appended to the request URL path, or to the client base URL path if the request has no URL
+// Placeholders are replaced by the escaped values set with SetPathParam
+func (r *Request) SetPath(path string) *Request {
+	r.path = path
+
+	return r
+}
+
+// SetPathParam sets the value of a path template placeholder
+func (r *Request) SetPathParam(name, value string) *Request {
+	if r.pathParams == nil {
+		r.pathParams = map[string]string{}
+	}
+
+	r.pathParams[name] = value
+
+	return r
+}
+
+// SetPathParams sets the values of path template placeholders
+func (r *Request) SetPathParams(params map[string]string) *Request {
+	for name, value := range params {
+		r.SetPathParam(name, value)
+	}
+
+	return r
+}
+
+// SetQueryParam sets a query parameter, replacing any values of the same key
+func (r *Request) SetQueryParam(key, value string) *Request {
+	r.queryValues().Set(key, value)
+
+	return r
+}
+
+// AddQueryParam adds a value to a query parameter
+func (r *Request) AddQueryParam(key, value string) *Request {
+	r.queryValues().Add(key, value)
+
+	return r
+}
+
+// SetQueryParams sets query parameters, replacing any values of the same keys
+func (r *Request) SetQueryParams(params url.Values) *Request {
+	q := r.queryValues()
+	for k, v := range params {
+		q[k] = append([]string(nil), v...)
+	}
+
+	return r
+}
+
+// SetQueryStruct sets query parameters from the fields of a struct, using `url:"name,omitempty"` tags
+// Slices add one value per element, time.Time is formatted as RFC 3339, nil pointers are skipped
+// and embedded structs are flattened
+// Encoding errors are returned when the request is sent
+func (r *Request) SetQueryStruct(v any) *Request {
+	params, err := encodeQueryStruct(v)
+	if err != nil {
+		r.err = err
+
+		return r
+	}
+
+	return r.SetQueryParams(params)
+}
+
+func (r *Request) queryValues() url.Values {
+	if r.query == nil {
+		r.query = url.Values{}
+	}
+
+	return r.query
+}
+
 // SetRequestBody sets the body of the request
+// An io.Reader body is streamed as is instead of being encoded
 func (r *Request) SetRequestBody(body interface{}) *Request {
 	r.Body = body
 
 	return r
 }
 
+// SetBodyReader sets a body streamed from the reader as is, without encoding or buffering it
+// The size is sent as Content-Length, pass -1 if it is unknown
+// Seekable readers are rewound for retries and redirects, other readers can only be sent once
+// The reader is not closed
+func (r *Request) SetBodyReader(body io.Reader, size int64) *Request {
+	r.Body = body
+	r.body = newBodyReader(body, size)
+
+	return r
+}
+
+// streamedBody returns the body reader of the request, if its body is an io.Reader
+func (r *Request) streamedBody() *bodyReader {
+	rd, ok := r.Body.(io.Reader)
+	if !ok {
+		return nil
+	}
+
+	if r.body == nil || r.body.r != rd {
+		r.body = newBodyReader(rd, -1)
+	}
+
+	return r.body
+}
+
+// rewindable reports whether the request body can be sent again
+func (r *Request) rewindable() bool {
+	if len(r.multipart) > 0 {
+		return multipartRewindable(r.multipart)
+	}
+
+	if b := r.streamedBody(); b != nil {
+		return b.rewindable()
+	}
+
+	return true
+}
+
+// SetFormBody sets an application/x-www-form-urlencoded body
+// The form can be url.Values, map[string]string or a struct with `url` tags
+func (r *Request) SetFormBody(form any) *Request {
+	r.Body = form
+
+	return r.SetHeader("Content-Type", FormContentType)
+}
+
+// AddFormField adds a field to the multipart/form-data body of the request
+// Once a multipart field or file is added, the request is sent as a multipart form and Body is ignored
+func (r *Request) AddFormField(name, value string) *Request {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(name)))
+
+	r.multipart = append(r.multipart, multipartPart{header: h, value: value})
+
+	return r
+}
+
+// AddFile adds a file to the multipart/form-data body of the request
+// The content is streamed from the reader when the request is sent, and the part Content-Type
+// is guessed from the file extension
+func (r *Request) AddFile(field, filename string, content io.Reader) *Request {
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(field), escapeQuotes(filename)))
+	h.Set("Content-Type", contentType)
+
+	return r.AddPart(h, content)
+}
+
+// AddPart adds a part with custom headers to the multipart/form-data body of the request
+// The content is streamed from the reader when the request is sent
+func (r *Request) AddPart(header textproto.MIMEHeader, content io.Reader) *Request {
+	r.multipart = append(r.multipart, multipartPart{header: header, body: newBodyReader(content, -1)})
+
+	return r
+}
+
 // SetWantedResponseBody sets the wanted response body struct
 func (r *Request) SetWantedResponseBody(responseBody interface{}) *Request {
 	r.response = responseBody
@@ -96,6 +291,73 @@ func (r *Request) SetWantedResponseBody(responseBody interface{}) *Request {
 	return r
 }
 
+// SetResponseWriter streams the success response body to w instead of buffering it in memory
+// The body is neither decoded nor returned, error responses are handled as usual
+func (r *Request) SetResponseWriter(w io.Writer) *Request {
+	d := r.downloadOptions()
+	d.writer = w
+	d.path = ""
+
+	return r
+}
+
+// DownloadTo streams the success response body to the file at path, which is created or truncated
+func (r *Request) DownloadTo(path string) *Request {
+	d := r.downloadOptions()
+	d.path = path
+	d.writer = nil
+
+	return r
+}
+
+// SetProgressFunc sets a function called after each write of a streamed response body
+func (r *Request) SetProgressFunc(fn ProgressFunc) *Request {
+	r.downloadOptions().progress = fn
+
+	return r
+}
+
+// SetChecksum verifies a streamed response body against a hex or base64 SHA-256 digest
+// A mismatch returns ChecksumMismatchError, and removes the file of DownloadTo
+func (r *Request) SetChecksum(sha256 string) *Request {
+	r.downloadOptions().checksum = sha256
+
+	return r
+}
+
+// SetChecksumHeader verifies a streamed response body against the SHA-256 digest sent in a response header,
+// e.g. X-Checksum-Sha256 or Content-Digest
+func (r *Request) SetChecksumHeader(name string) *Request {
+	r.downloadOptions().checksumHeader = name
+
+	return r
+}
+
+// SetResumeAttempts sets how many times an interrupted streamed response body is resumed with a Range request,
+// when the server accepts ranges
+// DownloadTo also resumes a partial file left by an earlier download of the same version of the resource,
+// recorded in a <path>.resume file that is kept when a download fails
+func (r *Request) SetResumeAttempts(n int) *Request {
+	r.downloadOptions().resumes = n
+
+	return r
+}
+
+// SetMaxLineSize sets the longest line accepted when decoding a JSON lines body with DecodeLines
+func (r *Request) SetMaxLineSize(n int) *Request {
+	r.maxLineSize = n
+
+	return r
+}
+
+func (r *Request) downloadOptions() *download {
+	if r.download == nil {
+		r.download = &download{}
+	}
+
+	return r.download
+}
+
 // SetErrorResponseBody sets the error response body struct
 func (r *Request) SetErrorResponseBody(errorBody interface{}) *Request {
 	r.errorResponse = errorBody
@@ -111,37 +373,218 @@ func (r *Request) SetExpectedStatusCode(expectedStatusCode int) *Request {
 }
 
 // EnableRetries sets the number of retries for the request
+// The request is sent at most retries+1 times, waiting between attempts according to the retry policy
 func (r *Request) EnableRetries(retries int) *Request {
 	r.retries = retries
 
 	return r
 }
 
-// AddHeader adds a header to the request
-func (r *Request) AddHeader(key, value string) *Request {
-	r.Headers[key] = value
+// SetRetryPolicy sets the retry policy of the request, overriding the client default
+func (r *Request) SetRetryPolicy(policy *RetryPolicy) *Request {
+	r.retryPolicy = policy
+
+	return r
+}
 
-	if key == "Content-Type" {
-		r.contentType = value
+// AddHeader adds a value to a header of the request
+// Content-Type is single valued, and a header still holding its default value like Accept
+// is replaced by the first value added to it
+func (r *Request) AddHeader(key, value string) *Request {
+	if http.CanonicalHeaderKey(key) == "Content-Type" || r.holdsDefault(key) {
+		return r.SetHeader(key, value)
 	}
 
+	r.headers().Add(key, value)
+
+	return r
+}
+
+// SetHeader sets a header of the request, replacing any existing values
+func (r *Request) SetHeader(key, value string) *Request {
+	delete(r.defaulted, http.CanonicalHeaderKey(key))
+	r.headers().Set(key, value)
+
+	return r
+}
+
+// DelHeader removes a header from the request
+func (r *Request) DelHeader(key string) *Request {
+	delete(r.defaulted, http.CanonicalHeaderKey(key))
+	r.headers().Del(key)
+
 	return r
 }
 
-// Do sends the request and returns the response body as a byte slice
-// This will retry the request if the number of retries is set
+// holdsDefault reports whether a header still holds the value set by NewRequest
+func (r *Request) holdsDefault(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+
+	return r.defaulted[key] && slices.Equal(r.Headers[key], defaultHeaders[key])
+}
+
+func (r *Request) headers() http.Header {
+	if r.Headers == nil {
+		r.Headers = http.Header{}
+	}
+
+	return r.Headers
+}
+
+// contentType returns the Content-Type the request body is encoded as
+func (r *Request) contentType() string {
+	return r.Headers.Get("Content-Type")
+}
+
+// Send sends the request and returns the response body as a byte slice
+// This will retry the request according to the request or client retry policy
 func (r *Request) Send(ctx context.Context, c RequestClient) ([]byte, error) {
+	resp, err := r.Do(ctx, c)
+	if resp == nil {
+		return nil, err
+	}
+
+	return resp.Body, err
+}
+
+// Do sends the request like Send, but returns the full response of the last attempt
+// The response is nil if the request could not be sent
+func (r *Request) Do(ctx context.Context, c RequestClient) (*Response, error) {
+	policy := r.retryPolicyFor(c)
+	if policy == nil {
+		return r.execute(ctx, c)
+	}
+
+	logger := slog.Default()
+	if cl, ok := c.(*Client); ok {
+		logger = cl.logger
+	}
+
+	start := time.Now()
+	var backoff time.Duration
+
+	for attempt := 1; ; attempt++ {
+		r.statusCode = 0
+		r.responseHeader = nil
+		r.SetHeader("Retry-Count", fmt.Sprint(attempt-1))
+
+		resp, err := r.execute(ctx, c)
+		if err == nil || attempt >= policy.MaxAttempts || !policy.shouldRetry(ctx, r, err) {
+			return resp, err
+		}
+
+		if !r.rewindable() {
+			logger.Warn("not retrying request, body cannot be rewound", "attempt", attempt, "status", r.statusCode)
+
+			return resp, errors.Join(err, BodyNotRewindableError)
+		}
+
+		if !r.download.restartable() {
+			logger.Warn("not retrying request, response body was partially written", "attempt", attempt, "written", r.download.written)
+
+			return resp, err
+		}
+
+		backoff = policy.backoff(attempt, backoff)
+		wait := backoff
+
+		// The server knows best how long it needs, so its hint wins over a shorter backoff
+		ra, hinted := retryAfter(r.statusCode, r.responseHeader, time.Now())
+		if hinted {
+			wait = max(wait, min(ra, policy.MaxRetryAfter))
+		}
+
+		if policy.MaxElapsedTime > 0 && time.Since(start)+wait > policy.MaxElapsedTime {
+			return resp, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			logger.Warn("not retrying request, wait exceeds context deadline", "attempt", attempt, "wait", wait, "status", r.statusCode)
+
+			return resp, err
+		}
+
+		if hinted {
+			logger.Warn("retrying request after server requested delay", "attempt", attempt, "wait", wait, "retry_after", ra, "status", r.statusCode)
+		} else {
+			logger.Warn("retrying request", "attempt", attempt, "wait", wait, "status", r.statusCode, "error", err)
+		}
+
+		if serr := sleep(ctx, wait); serr != nil {
+			return resp, errors.Join(serr, err)
+		}
+	}
+}
+
+// execute makes a single attempt, using Execute when the client supports it
+func (r *Request) execute(ctx context.Context, c RequestClient) (*Response, error) {
+	if r.hedgeable() {
+		return r.hedged(ctx, c)
+	}
+
+	if e, ok := c.(interface {
+		Execute(context.Context, *Request) (*Response, error)
+	}); ok {
+		return e.Execute(ctx, r)
+	}
+
+	body, err := c.Do(ctx, r)
+	if body == nil && err != nil {
+		return nil, err
+	}
+
+	return r.newResponse(body), err
+}
+
+// retryPolicyFor returns the retry policy for the request, or nil if it should be sent once
+// EnableRetries overrides the number of attempts of the request or client policy
+func (r *Request) retryPolicyFor(c RequestClient) *RetryPolicy {
+	policy := r.retryPolicy
+	if cl, ok := c.(*Client); ok && policy == nil {
+		policy = cl.retryPolicy
+	}
+
 	if r.retries > 0 {
-		for i := 0; i < r.retries; i++ {
-			r.AddHeader("Retry-Count", fmt.Sprint(i))
-			body, err := c.Do(ctx, r)
-			if err == nil {
-				return body, nil
-			}
+		if policy == nil {
+			policy = DefaultRetryPolicy()
 		}
+
+		p := *policy
+		p.MaxAttempts = r.retries + 1
+		policy = &p
 	}
 
-	return c.Do(ctx, r)
+	if policy == nil {
+		return nil
+	}
+
+	return policy.withDefaults()
+}
+
+// idempotent reports whether the request can safely be sent more than once
+func (r *Request) idempotent() bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return r.Headers.Get("Idempotency-Key") != ""
+}
+
+// SetMetadata attaches a value to the request for use by middleware, it is never sent
+func (r *Request) SetMetadata(key string, value any) *Request {
+	if r.metadata == nil {
+		r.metadata = map[string]any{}
+	}
+
+	r.metadata[key] = value
+
+	return r
+}
+
+// GetMetadata returns a value attached with SetMetadata
+func (r *Request) GetMetadata(key string) any {
+	return r.metadata[key]
 }
 
 // GetResponse returns the decoded response body, if successful
@@ -1,12 +1,21 @@
 package gohans
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/madflojo/testcerts"
 	"github.com/stretchr/testify/assert"
@@ -74,11 +83,182 @@ func TestRequest_EnableRetries(t *testing.T) {
 	assert.Equal(t, request.retries, 3)
 }
 
+func TestRequest_SetRetryPolicy(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 5}
+	request := NewRequest().SetRetryPolicy(policy)
+
+	assert.Equal(t, policy, request.retryPolicy)
+}
+
+func TestRequest_retryPolicyFor(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no policy", func(t *testing.T) {
+		assert.Nil(t, NewRequest().retryPolicyFor(NewClient(ctx)))
+	})
+
+	t.Run("enable retries", func(t *testing.T) {
+		p := NewRequest().EnableRetries(4).retryPolicyFor(NewClient(ctx))
+		assert.Equal(t, 5, p.MaxAttempts)
+		assert.Equal(t, FullJitter, p.Jitter)
+	})
+
+	t.Run("client default", func(t *testing.T) {
+		client := NewClient(ctx, WithRetryPolicy(&RetryPolicy{MaxAttempts: 2, Jitter: NoJitter}))
+
+		p := NewRequest().retryPolicyFor(client)
+		assert.Equal(t, 2, p.MaxAttempts)
+		assert.Equal(t, NoJitter, p.Jitter)
+
+		p = NewRequest().EnableRetries(6).retryPolicyFor(client)
+		assert.Equal(t, 7, p.MaxAttempts)
+		assert.Equal(t, 2, client.retryPolicy.MaxAttempts)
+	})
+
+	t.Run("request overrides client", func(t *testing.T) {
+		client := NewClient(ctx, WithRetryPolicy(&RetryPolicy{MaxAttempts: 2}))
+
+		p := NewRequest().SetRetryPolicy(&RetryPolicy{MaxAttempts: 9}).retryPolicyFor(client)
+		assert.Equal(t, 9, p.MaxAttempts)
+	})
+}
+
+func TestRequest_idempotent(t *testing.T) {
+	for _, m := range []string{"GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE"} {
+		assert.True(t, NewRequest().SetMethod(m).idempotent(), m)
+	}
+
+	for _, m := range []string{"POST", "PATCH"} {
+		assert.False(t, NewRequest().SetMethod(m).idempotent(), m)
+	}
+
+	r := NewRequest().SetMethod("POST")
+	r.SetHeader("Idempotency-Key", "abc")
+	assert.True(t, r.idempotent())
+}
+
+func TestRequest_SetMetadata(t *testing.T) {
+	request := NewRequest()
+	assert.Nil(t, request.GetMetadata("operation"))
+
+	request.SetMetadata("operation", "list-users")
+	assert.Equal(t, "list-users", request.GetMetadata("operation"))
+}
+
 func TestRequest_AddHeader(t *testing.T) {
 	request := NewRequest()
 	request.AddHeader("key", "value")
 
-	assert.Equal(t, request.Headers["key"], "value")
+	assert.Equal(t, request.Headers.Get("key"), "value")
+
+	request.AddHeader("Key", "other")
+	assert.Equal(t, []string{"value", "other"}, request.Headers.Values("key"))
+
+	request.AddHeader("content-type", XMLContentType)
+	assert.Equal(t, []string{XMLContentType}, request.Headers.Values("Content-Type"))
+	assert.Equal(t, XMLContentType, request.contentType())
+
+	// The default Accept is replaced by the first added value, then values are added
+	request.AddHeader("Accept", XMLContentType)
+	assert.Equal(t, []string{XMLContentType}, request.Headers.Values("Accept"))
+
+	request.AddHeader("Accept", JSONContentType)
+	assert.Equal(t, []string{XMLContentType, JSONContentType}, request.Headers.Values("Accept"))
+}
+
+func TestRequest_SetHeader(t *testing.T) {
+	request := NewRequest().
+		AddHeader("X-Tag", "a").
+		AddHeader("X-Tag", "b").
+		SetHeader("x-tag", "c")
+
+	assert.Equal(t, []string{"c"}, request.Headers.Values("X-Tag"))
+
+	request.SetHeader("Content-Type", "text/xml")
+	assert.Equal(t, "text/xml", request.contentType())
+}
+
+func TestRequest_DelHeader(t *testing.T) {
+	request := NewRequest().SetHeader("X-Tag", "a").DelHeader("x-tag").DelHeader("Content-Type")
+
+	assert.Empty(t, request.Headers.Values("X-Tag"))
+	assert.Equal(t, "", request.contentType())
+	assert.Equal(t, JSONContentType, request.Headers.Get("Accept"))
+}
+
+func TestRequest_headersAreNotShared(t *testing.T) {
+	first := NewRequest().SetAuthToken("first").SetHeader("Content-Type", XMLContentType)
+	second := NewRequest()
+
+	assert.Equal(t, "Bearer first", first.Headers.Get("Authorization"))
+	assert.Empty(t, second.Headers.Get("Authorization"))
+	assert.Equal(t, JSONContentType, second.contentType())
+	assert.Equal(t, http.Header{"Content-Type": {JSONContentType}, "Accept": {JSONContentType}}, defaultHeaders)
+
+	var literal Request
+	literal.SetHeader("X-Tag", "a")
+	assert.Equal(t, "a", literal.Headers.Get("X-Tag"))
+}
+
+func TestRequest_SetPath(t *testing.T) {
+	request := NewRequest().
+		SetPath("/users/{id}/orders/{orderID}").
+		SetPathParam("id", "1").
+		SetPathParams(map[string]string{"orderID": "2", "id": "3"})
+
+	assert.Equal(t, "/users/{id}/orders/{orderID}", request.path)
+	assert.Equal(t, map[string]string{"id": "3", "orderID": "2"}, request.pathParams)
+}
+
+func TestRequest_QueryParams(t *testing.T) {
+	request := NewRequest().
+		SetQueryParam("page", "1").
+		SetQueryParam("page", "2").
+		AddQueryParam("tag", "a").
+		AddQueryParam("tag", "b").
+		SetQueryParams(url.Values{"sort": {"name"}, "tag": {"c"}})
+
+	assert.Equal(t, url.Values{"page": {"2"}, "tag": {"c"}, "sort": {"name"}}, request.query)
+	assert.NoError(t, request.err)
+}
+
+func TestRequest_SetQueryStruct(t *testing.T) {
+	request := NewRequest().
+		SetQueryParam("sort", "name").
+		SetQueryStruct(struct {
+			Page int      `url:"page"`
+			Tags []string `url:"tag"`
+		}{Page: 3, Tags: []string{"a", "b"}})
+
+	assert.NoError(t, request.err)
+	assert.Equal(t, url.Values{"page": {"3"}, "tag": {"a", "b"}, "sort": {"name"}}, request.query)
+
+	request = NewRequest().SetQueryStruct("not a struct")
+	assert.Error(t, request.err)
+}
+
+func TestRequest_SetFormBody(t *testing.T) {
+	form := url.Values{"a": {"1"}}
+	request := NewRequest().SetFormBody(form)
+
+	assert.Equal(t, form, request.Body)
+	assert.Equal(t, FormContentType, request.contentType())
+}
+
+func TestRequest_Multipart(t *testing.T) {
+	file := strings.NewReader("data")
+	request := NewRequest().
+		AddFormField("name", "value").
+		AddFile("upload", `my "photo".png`, file).
+		AddFile("other", "blob", file)
+
+	assert.Len(t, request.multipart, 3)
+	assert.Equal(t, "value", request.multipart[0].value)
+	assert.Equal(t, `form-data; name="name"`, request.multipart[0].header.Get("Content-Disposition"))
+	assert.Equal(t, `form-data; name="upload"; filename="my \"photo\".png"`, request.multipart[1].header.Get("Content-Disposition"))
+	assert.Equal(t, "image/png", request.multipart[1].header.Get("Content-Type"))
+	assert.Equal(t, file, request.multipart[1].body.r)
+	assert.Equal(t, "application/octet-stream", request.multipart[2].header.Get("Content-Type"))
 }
 
 func TestRequest_SetRequestBody(t *testing.T) {
@@ -86,6 +266,33 @@ func TestRequest_SetRequestBody(t *testing.T) {
 	request.SetRequestBody("body")
 
 	assert.Equal(t, request.Body, "body")
+	assert.Nil(t, request.streamedBody())
+
+	body := strings.NewReader("body")
+	request.SetRequestBody(body)
+	assert.Equal(t, body, request.streamedBody().r)
+	assert.Equal(t, int64(4), request.streamedBody().size)
+}
+
+func TestRequest_SetBodyReader(t *testing.T) {
+	body := io.LimitReader(zeroReader{}, 10)
+	request := NewRequest().SetBodyReader(body, 10)
+
+	assert.Equal(t, body, request.Body)
+	assert.Equal(t, int64(10), request.streamedBody().size)
+	assert.True(t, request.rewindable())
+
+	_, err := request.streamedBody().reader()
+	assert.NoError(t, err)
+	assert.False(t, request.rewindable())
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+
+	return len(p), nil
 }
 
 func TestRequest_Send(t *testing.T) {
@@ -158,6 +365,395 @@ func TestRequest_Send(t *testing.T) {
 		assert.Equal(t, 500, r.GetStatusCode())
 	})
 
+	t.Run("query params", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, url.Values{
+				"page":   {"2"},
+				"sort":   {"name"},
+				"tag":    {"a", "b"},
+				"filter": {"a b&c"},
+			}, r.URL.Query())
+
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		_, err := NewRequest().
+			SetURL(server.URL+"?page=1&sort=name").
+			SetQueryParam("page", "2").
+			SetQueryParam("filter", "a b&c").
+			SetQueryStruct(struct {
+				Tags []string `url:"tag"`
+			}{Tags: []string{"a", "b"}}).
+			Send(ctx, client)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid query struct", func(t *testing.T) {
+		body, err := NewRequest().
+			SetURL("http://localhost").
+			SetQueryStruct(42).
+			Send(ctx, client)
+
+		assert.Nil(t, body)
+		assert.EqualError(t, err, "query: expected a struct, got int")
+	})
+
+	t.Run("concurrent requests", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.URL.Query().Get("id")
+			assert.Equal(t, "Bearer token-"+id, r.Header.Get("Authorization"))
+			assert.Equal(t, []string{"a-" + id, "b-" + id}, r.Header.Values("X-Tag"))
+			assert.Equal(t, "default", r.Header.Get("X-Client"))
+
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"status": "ok"}`))
+		}))
+		defer server.Close()
+
+		client := NewClient(ctx, WithDefaultHeaders(http.Header{"X-Client": {"default"}}))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+
+				_, err := NewRequest().
+					SetURL(server.URL).
+					SetQueryParam("id", id).
+					SetAuthToken("token-"+id).
+					AddHeader("X-Tag", "a-"+id).
+					AddHeader("X-Tag", "b-"+id).
+					Send(ctx, client)
+
+				assert.NoError(t, err)
+			}(fmt.Sprint(i))
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("form body", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, FormContentType, r.Header.Get("Content-Type"))
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, url.Values{"grant_type": {"client_credentials"}, "scope": {"read", "write"}}, r.PostForm)
+
+			w.Header().Set("Content-Type", FormContentType)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`status=ok`))
+		}))
+		defer server.Close()
+
+		var out url.Values
+
+		_, err := NewRequest().
+			SetMethod(http.MethodPost).
+			SetURL(server.URL).
+			SetFormBody(struct {
+				GrantType string   `url:"grant_type"`
+				Scope     []string `url:"scope"`
+			}{GrantType: "client_credentials", Scope: []string{"read", "write"}}).
+			SetWantedResponseBody(&out).
+			Send(ctx, client)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", out.Get("status"))
+	})
+
+	t.Run("multipart body", func(t *testing.T) {
+		const size = 4 << 20
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Streamed bodies are sent chunked, without a known length
+			assert.Equal(t, int64(-1), r.ContentLength)
+
+			mr, err := r.MultipartReader()
+			assert.NoError(t, err)
+
+			p, err := mr.NextPart()
+			assert.NoError(t, err)
+			assert.Equal(t, "title", p.FormName())
+
+			p, err = mr.NextPart()
+			assert.NoError(t, err)
+			assert.Equal(t, "report.bin", p.FileName())
+			n, err := io.Copy(io.Discard, p)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(size), n)
+
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"status": "ok"}`))
+		}))
+		defer server.Close()
+
+		_, err := NewRequest().
+			SetMethod(http.MethodPost).
+			SetURL(server.URL).
+			AddFormField("title", "report").
+			AddFile("file", "report.bin", io.LimitReader(zeroReader{}, size)).
+			Send(ctx, client)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("streamed body", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			body   func() *Request
+			length int64
+		}{
+			{"known size", func() *Request { return NewRequest().SetBodyReader(strings.NewReader("streamed"), -1) }, 8},
+			{"explicit size", func() *Request {
+				return NewRequest().SetBodyReader(io.LimitReader(strings.NewReader("streamed"), 8), 8)
+			}, 8},
+			{"unknown size", func() *Request {
+				return NewRequest().SetRequestBody(io.LimitReader(strings.NewReader("streamed"), 8))
+			}, -1},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t, tt.length, r.ContentLength)
+
+					b, _ := io.ReadAll(r.Body)
+					assert.Equal(t, "streamed", string(b))
+
+					w.WriteHeader(http.StatusOK)
+				}))
+				defer server.Close()
+
+				_, err := tt.body().SetMethod(http.MethodPut).SetURL(server.URL).Send(ctx, client)
+				assert.NoError(t, err)
+			})
+		}
+
+		t.Run("empty", func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, int64(0), r.ContentLength)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			_, err := NewRequest().SetMethod(http.MethodPut).SetURL(server.URL).SetBodyReader(bytes.NewReader(nil), 0).Send(ctx, client)
+			assert.NoError(t, err)
+		})
+	})
+
+	t.Run("streamed body retry", func(t *testing.T) {
+		fast := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+		newServer := func(calls *atomic.Int32) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				assert.Equal(t, "file content", string(b))
+
+				if calls.Add(1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+			}))
+		}
+
+		t.Run("seekable file is rewound and not closed", func(t *testing.T) {
+			var calls atomic.Int32
+			server := newServer(&calls)
+			defer server.Close()
+
+			f, err := os.CreateTemp(t.TempDir(), "body")
+			assert.NoError(t, err)
+			defer f.Close()
+
+			_, err = f.WriteString("file content")
+			assert.NoError(t, err)
+			_, err = f.Seek(0, io.SeekStart)
+			assert.NoError(t, err)
+
+			_, err = NewRequest().
+				SetMethod(http.MethodPut).
+				SetURL(server.URL).
+				SetBodyReader(f, -1).
+				SetRetryPolicy(fast).
+				Send(ctx, client)
+
+			assert.NoError(t, err)
+			assert.Equal(t, int32(2), calls.Load())
+
+			// The caller still owns the file
+			_, err = f.Seek(0, io.SeekStart)
+			assert.NoError(t, err)
+		})
+
+		t.Run("non seekable reader is not retried", func(t *testing.T) {
+			var calls atomic.Int32
+			server := newServer(&calls)
+			defer server.Close()
+
+			_, err := NewRequest().
+				SetMethod(http.MethodPut).
+				SetURL(server.URL).
+				SetBodyReader(io.LimitReader(strings.NewReader("file content"), 12), 12).
+				SetRetryPolicy(fast).
+				Send(ctx, client)
+
+			assert.ErrorIs(t, err, BodyNotRewindableError)
+			assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+			assert.Equal(t, int32(1), calls.Load())
+		})
+
+		t.Run("multipart file is rewound", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.NoError(t, r.ParseMultipartForm(1<<20))
+				f, _, err := r.FormFile("file")
+				assert.NoError(t, err)
+				b, _ := io.ReadAll(f)
+				assert.Equal(t, "file content", string(b))
+
+				if calls.Add(1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			_, err := NewRequest().
+				SetMethod(http.MethodPut).
+				SetURL(server.URL).
+				AddFile("file", "a.txt", strings.NewReader("file content")).
+				SetRetryPolicy(fast).
+				Send(ctx, client)
+
+			assert.NoError(t, err)
+			assert.Equal(t, int32(2), calls.Load())
+		})
+	})
+
+	t.Run("streamed body redirect", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+		})
+		mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "moved body", string(b))
+			assert.Equal(t, int64(10), r.ContentLength)
+
+			w.WriteHeader(http.StatusOK)
+		})
+
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		_, err := NewRequest().
+			SetMethod(http.MethodPost).
+			SetURL(server.URL+"/old").
+			SetBodyReader(strings.NewReader("moved body"), -1).
+			Send(ctx, client)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("streamed body answered before it is sent", func(t *testing.T) {
+		// answerEarly sends the response, then reads the body while the client moves on to the next attempt
+		answerEarly := func(w http.ResponseWriter, r *http.Request) {
+			w.(http.Flusher).Flush()
+			io.Copy(io.Discard, r.Body)
+		}
+
+		large := bytes.Repeat([]byte("0123456789abcdef"), 1<<20)
+
+		t.Run("redirect", func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+				answerEarly(w, r)
+			})
+			mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				assert.Equal(t, len(large), len(b))
+				assert.True(t, bytes.Equal(large, b))
+
+				w.WriteHeader(http.StatusOK)
+			})
+
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			_, err := NewRequest().
+				SetMethod(http.MethodPost).
+				SetURL(server.URL+"/old").
+				SetBodyReader(bytes.NewReader(large), -1).
+				Send(ctx, client)
+
+			assert.NoError(t, err)
+		})
+
+		t.Run("multipart redirect", func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+				answerEarly(w, r)
+			})
+			mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+				assert.NoError(t, r.ParseMultipartForm(1<<20))
+				f, _, err := r.FormFile("file")
+				assert.NoError(t, err)
+				b, _ := io.ReadAll(f)
+				assert.True(t, bytes.Equal(large, b))
+
+				w.WriteHeader(http.StatusOK)
+			})
+
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			_, err := NewRequest().
+				SetMethod(http.MethodPost).
+				SetURL(server.URL+"/old").
+				AddFile("file", "large.bin", bytes.NewReader(large)).
+				Send(ctx, client)
+
+			assert.NoError(t, err)
+		})
+
+		t.Run("retry", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					answerEarly(w, r)
+					return
+				}
+
+				b, _ := io.ReadAll(r.Body)
+				assert.True(t, bytes.Equal(large, b))
+
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			_, err := NewRequest().
+				SetMethod(http.MethodPut).
+				SetURL(server.URL).
+				SetBodyReader(bytes.NewReader(large), -1).
+				SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}).
+				Send(ctx, client)
+
+			assert.NoError(t, err)
+			assert.Equal(t, int32(2), calls.Load())
+		})
+	})
+
 	t.Run("missing url", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
@@ -227,6 +823,220 @@ func TestRequest_Send(t *testing.T) {
 		assert.Equal(t, &ok, r.GetResponse())
 	})
 
+	t.Run("retry policy", func(t *testing.T) {
+		fast := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+		t.Run("stops after max attempts", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error": "unavailable"}`))
+			}))
+			defer server.Close()
+
+			_, err := NewRequest().SetURL(server.URL).SetRetryPolicy(fast).Send(ctx, client)
+
+			assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+			assert.Equal(t, int32(3), calls.Load())
+		})
+
+		t.Run("does not retry client errors", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "bad request"}`))
+			}))
+			defer server.Close()
+
+			r := NewRequest().SetURL(server.URL).SetRetryPolicy(fast)
+			_, err := r.Send(ctx, client)
+
+			assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+			assert.Equal(t, int32(1), calls.Load())
+			assert.Equal(t, http.StatusBadRequest, r.GetStatusCode())
+		})
+
+		t.Run("does not retry non idempotent methods", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error": "unavailable"}`))
+			}))
+			defer server.Close()
+
+			_, err := NewRequest().SetMethod(http.MethodPost).SetURL(server.URL).SetRetryPolicy(fast).Send(ctx, client)
+			assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+			assert.Equal(t, int32(1), calls.Load())
+
+			p := *fast
+			p.RetryNonIdempotent = true
+			_, err = NewRequest().SetMethod(http.MethodPost).SetURL(server.URL).SetRetryPolicy(&p).Send(ctx, client)
+			assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+			assert.Equal(t, int32(4), calls.Load())
+		})
+
+		t.Run("retries connection errors", func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			u := server.URL
+			server.Close()
+
+			r := NewRequest().SetURL(u).SetRetryPolicy(fast)
+			_, err := r.Send(ctx, client)
+
+			assert.Error(t, err)
+			assert.True(t, RetryableError(err))
+			assert.Equal(t, 0, r.GetStatusCode())
+		})
+
+		t.Run("context canceled during backoff", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error": "unavailable"}`))
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(ctx)
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			slow := &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Jitter: NoJitter}
+
+			start := time.Now()
+			_, err := NewRequest().SetURL(server.URL).SetRetryPolicy(slow).Send(ctx, client)
+
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Equal(t, int32(1), calls.Load())
+		})
+
+		t.Run("max elapsed time", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error": "unavailable"}`))
+			}))
+			defer server.Close()
+
+			p := &RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, Jitter: NoJitter, MaxElapsedTime: 500 * time.Millisecond}
+
+			_, err := NewRequest().SetURL(server.URL).SetRetryPolicy(p).Send(ctx, client)
+
+			assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+			assert.Equal(t, int32(1), calls.Load())
+		})
+
+		t.Run("honors retry after", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) < 2 {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusTooManyRequests)
+					w.Write([]byte(`{"error": "slow down"}`))
+
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"status": "ok"}`))
+			}))
+			defer server.Close()
+
+			var logs bytes.Buffer
+			client := NewClient(ctx, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+			start := time.Now()
+			_, err := NewRequest().SetURL(server.URL).SetRetryPolicy(fast).Send(ctx, client)
+
+			assert.NoError(t, err)
+			assert.Equal(t, int32(2), calls.Load())
+			assert.GreaterOrEqual(t, time.Since(start), time.Second)
+			assert.Contains(t, logs.String(), "retry_after=1s")
+		})
+
+		t.Run("caps retry after", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) < 2 {
+					w.Header().Set("Retry-After", "3600")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					w.Write([]byte(`{"error": "maintenance"}`))
+
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"status": "ok"}`))
+			}))
+			defer server.Close()
+
+			p := *fast
+			p.MaxRetryAfter = 10 * time.Millisecond
+
+			_, err := NewRequest().SetURL(server.URL).SetRetryPolicy(&p).Send(ctx, client)
+
+			assert.NoError(t, err)
+			assert.Equal(t, int32(2), calls.Load())
+		})
+
+		t.Run("retry after beyond context deadline", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.Header().Set("Retry-After", "30")
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"error": "slow down"}`))
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+
+			start := time.Now()
+			r := NewRequest().SetURL(server.URL).SetRetryPolicy(fast)
+			_, err := r.Send(ctx, client)
+
+			assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+			assert.NotErrorIs(t, err, context.DeadlineExceeded)
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Equal(t, int32(1), calls.Load())
+			assert.Equal(t, http.StatusTooManyRequests, r.GetStatusCode())
+		})
+
+		t.Run("client default policy", func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) < 2 {
+					w.WriteHeader(http.StatusBadGateway)
+					w.Write([]byte(`{"error": "bad gateway"}`))
+
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"status": "ok"}`))
+			}))
+			defer server.Close()
+
+			client := NewClient(ctx, WithRetryPolicy(fast))
+
+			var ok struct {
+				Status string `json:"status"`
+			}
+
+			_, err := NewRequest().SetURL(server.URL).SetWantedResponseBody(&ok).Send(ctx, client)
+
+			assert.NoError(t, err)
+			assert.Equal(t, "ok", ok.Status)
+			assert.Equal(t, int32(2), calls.Load())
+		})
+	})
+
 	t.Run("https & tls certs", func(t *testing.T) {
 		ctx := context.Background()
 		// Generate Certificate Authority
@@ -0,0 +1,100 @@
+package gohans
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Response holds the outcome of a sent request
+type Response struct {
+	StatusCode int
+	// Proto is the protocol version of the response, e.g. HTTP/1.1 or HTTP/2.0
+	Proto   string
+	Header  http.Header
+	Trailer http.Header
+	// Body is the raw response body
+	Body []byte
+	// Decoded is the decoded success body, or the decoded error body for unexpected status codes
+	Decoded any
+	// URL is the final URL of the request, after following redirects
+	URL     *url.URL
+	Timings Timings
+}
+
+// Timings holds the duration of each phase of a request
+// Phases that did not happen, such as DNS lookup on a reused connection, are zero
+type Timings struct {
+	DNSLookup    time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// TimeToFirstByte is the time from sending the request to receiving the first response byte
+	TimeToFirstByte time.Duration
+	// Total is the time from sending the request to reading the whole response body
+	Total time.Duration
+}
+
+// newResponse returns the response recorded on the request by the last attempt
+// It is used for clients that only return the response body
+func (r *Request) newResponse(body []byte) *Response {
+	return &Response{
+		StatusCode: r.statusCode,
+		Header:     r.responseHeader,
+		Body:       body,
+	}
+}
+
+// timer records request phase timings from httptrace callbacks
+// Callbacks can run on transport goroutines, so fields are guarded by a mutex
+type timer struct {
+	mu sync.Mutex
+
+	start               time.Time
+	dnsStart, dnsDone   time.Time
+	connStart, connDone time.Time
+	tlsStart, tlsDone   time.Time
+	firstByte           time.Time
+}
+
+func (t *timer) record(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *timer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.record(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.record(&t.dnsDone) },
+		ConnectStart:         func(string, string) { t.record(&t.connStart) },
+		ConnectDone:          func(string, string, error) { t.record(&t.connDone) },
+		TLSHandshakeStart:    func() { t.record(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.record(&t.tlsDone) },
+		GotFirstResponseByte: func() { t.record(&t.firstByte) },
+	}
+}
+
+func (t *timer) timings() Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Timings{
+		DNSLookup:       between(t.dnsStart, t.dnsDone),
+		Connect:         between(t.connStart, t.connDone),
+		TLSHandshake:    between(t.tlsStart, t.tlsDone),
+		TimeToFirstByte: between(t.start, t.firstByte),
+		Total:           time.Since(t.start),
+	}
+}
+
+// between returns the duration between two recorded instants, or zero if either is missing
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+
+	return end.Sub(start)
+}
@@ -0,0 +1,131 @@
+package gohans
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Execute(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Link", `</new?page=2>; rel="next"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+		w.Header().Set("X-Checksum", "abc")
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "bad"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("success", func(t *testing.T) {
+		var ok struct {
+			Status string `json:"status"`
+		}
+
+		resp, err := client.Execute(ctx, NewRequest().SetURL(server.URL+"/old").SetWantedResponseBody(&ok))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "HTTP/1.1", resp.Proto)
+		assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+		assert.Equal(t, `</new?page=2>; rel="next"`, resp.Header.Get("Link"))
+		assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+		assert.Equal(t, `{"status": "ok"}`, string(resp.Body))
+		assert.Equal(t, &ok, resp.Decoded)
+		assert.Equal(t, "ok", ok.Status)
+		assert.Equal(t, server.URL+"/new", resp.URL.String())
+
+		assert.Greater(t, resp.Timings.Total, time.Duration(0))
+		assert.Greater(t, resp.Timings.TimeToFirstByte, time.Duration(0))
+		assert.LessOrEqual(t, resp.Timings.TimeToFirstByte, resp.Timings.Total)
+	})
+
+	t.Run("unexpected status", func(t *testing.T) {
+		var e Error
+
+		resp, err := client.Execute(ctx, NewRequest().SetURL(server.URL+"/fail").SetErrorResponseBody(&e))
+
+		assert.ErrorIs(t, err, UnexpectedStatusCodeError)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, &e, resp.Decoded)
+		assert.Equal(t, "bad", e.Error)
+	})
+
+	t.Run("not sent", func(t *testing.T) {
+		resp, err := client.Execute(ctx, NewRequest())
+
+		assert.Nil(t, resp)
+		assert.Equal(t, MissingURLError, err)
+	})
+}
+
+type bodyOnlyClient struct {
+	body []byte
+	err  error
+}
+
+func (c bodyOnlyClient) Do(_ context.Context, r *Request) ([]byte, error) {
+	r.statusCode = http.StatusOK
+	r.responseHeader = http.Header{"X-Test": {"1"}}
+
+	return c.body, c.err
+}
+
+func TestRequest_Do(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("client", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		resp, err := NewRequest().
+			SetURL(server.URL).
+			SetExpectedStatusCode(http.StatusNoContent).
+			Do(ctx, NewClient(ctx))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Empty(t, resp.Body)
+		assert.Nil(t, resp.Decoded)
+	})
+
+	t.Run("request client without Execute", func(t *testing.T) {
+		resp, err := NewRequest().Do(ctx, bodyOnlyClient{body: []byte(`{}`)})
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "1", resp.Header.Get("X-Test"))
+		assert.Equal(t, `{}`, string(resp.Body))
+
+		resp, err = NewRequest().Do(ctx, bodyOnlyClient{err: MissingURLError})
+		assert.Nil(t, resp)
+		assert.Equal(t, MissingURLError, err)
+	})
+}
+
+func Test_between(t *testing.T) {
+	now := time.Now()
+
+	assert.Equal(t, time.Second, between(now, now.Add(time.Second)))
+	assert.Equal(t, time.Duration(0), between(time.Time{}, now))
+	assert.Equal(t, time.Duration(0), between(now, time.Time{}))
+}
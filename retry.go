@@ -0,0 +1,251 @@
+package gohans
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Jitter controls how randomness is applied to the backoff between attempts
+type Jitter int
+
+const (
+	// NoJitter waits exactly the exponential backoff
+	NoJitter Jitter = iota
+	// FullJitter waits a random duration between zero and the exponential backoff
+	FullJitter
+	// DecorrelatedJitter waits a random duration between the initial backoff and three times the previous wait
+	DecorrelatedJitter
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+	defaultMultiplier     = 2
+	defaultMaxRetryAfter  = time.Minute
+)
+
+// RetryPolicy describes when a failed request is sent again and how long to wait in between
+// Zero values are replaced by the defaults of DefaultRetryPolicy
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every attempt
+	Multiplier float64
+	// Jitter randomizes the backoff to spread retries of concurrent callers
+	Jitter Jitter
+	// MaxElapsedTime stops retrying once the next attempt would start after it, zero means no limit
+	MaxElapsedTime time.Duration
+	// MaxRetryAfter caps the wait requested by a server through the Retry-After or X-RateLimit-Reset headers
+	MaxRetryAfter time.Duration
+	// RetryOnStatus reports whether an unexpected status code should be retried
+	RetryOnStatus func(statusCode int) bool
+	// RetryOnError reports whether an error that produced no response should be retried
+	RetryOnError func(err error) bool
+	// RetryNonIdempotent allows retrying POST, PATCH and other non idempotent methods
+	// Requests carrying an Idempotency-Key header are always considered idempotent
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy returns a policy making 3 attempts with an exponential, fully jittered backoff
+// starting at 100ms, retrying on RetryableStatus and RetryableError
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    defaultMaxAttempts,
+		InitialBackoff: defaultInitialBackoff,
+		MaxBackoff:     defaultMaxBackoff,
+		Multiplier:     defaultMultiplier,
+		MaxRetryAfter:  defaultMaxRetryAfter,
+		Jitter:         FullJitter,
+		RetryOnStatus:  RetryableStatus,
+		RetryOnError:   RetryableError,
+	}
+}
+
+// RetryableStatus reports whether a status code is usually transient:
+// 408 Request Timeout, 429 Too Many Requests and 5xx except 501 Not Implemented and 505 HTTP Version Not Supported
+func RetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+
+	return statusCode >= 500 && statusCode <= 599
+}
+
+// RetryableError reports whether an error is a transient network failure,
+// such as a timeout, a refused or reset connection or a connection closed mid response
+func RetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// url.Error implements net.Error itself, so look at what it wraps
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+
+	var oe *net.OpError
+	if errors.As(err, &oe) {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// withDefaults returns a copy of the policy with zero values replaced by defaults
+func (p RetryPolicy) withDefaults() *RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultMaxAttempts
+	}
+
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultInitialBackoff
+	}
+
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultMaxBackoff
+	}
+
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultMultiplier
+	}
+
+	if p.MaxRetryAfter <= 0 {
+		p.MaxRetryAfter = defaultMaxRetryAfter
+	}
+
+	if p.RetryOnStatus == nil {
+		p.RetryOnStatus = RetryableStatus
+	}
+
+	if p.RetryOnError == nil {
+		p.RetryOnError = RetryableError
+	}
+
+	return &p
+}
+
+// backoff returns the wait before retry number n (starting at 1), given the previous wait
+func (p *RetryPolicy) backoff(n int, prev time.Duration) time.Duration {
+	if p.Jitter == DecorrelatedJitter {
+		prev = max(prev, p.InitialBackoff)
+		spread := 3*prev - p.InitialBackoff
+
+		return min(p.InitialBackoff+rand.N(spread+1), p.MaxBackoff)
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(n-1))
+	wait := p.MaxBackoff
+	if d < float64(p.MaxBackoff) {
+		wait = time.Duration(d)
+	}
+
+	if p.Jitter == FullJitter {
+		return rand.N(wait + 1)
+	}
+
+	return wait
+}
+
+// retryAfter returns the wait requested by a 429 or 503 response
+// through the Retry-After header (seconds or HTTP date) or the X-RateLimit-Reset header
+// (seconds, or a unix timestamp for large values)
+func retryAfter(statusCode int, header http.Header, now time.Time) (time.Duration, bool) {
+	if statusCode != http.StatusTooManyRequests && statusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	if v := strings.TrimSpace(header.Get("Retry-After")); v != "" {
+		if s, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Duration(max(s, 0)) * time.Second, true
+		}
+
+		if t, err := http.ParseTime(v); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+	}
+
+	if v := header.Get("X-RateLimit-Reset"); v != "" {
+		reset, ok := rateLimitReset(v, now)
+		if !ok {
+			return 0, false
+		}
+
+		return max(reset.Sub(now), 0), true
+	}
+
+	return 0, false
+}
+
+// rateLimitReset parses an X-RateLimit-Reset value, either a Unix timestamp or a number of seconds from now
+// Deltas are small and timestamps are past 2001, so values from 1e9 on are timestamps
+func rateLimitReset(v string, now time.Time) (time.Time, bool) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return time.Time{}, false
+	}
+
+	if n >= 1e9 {
+		sec, frac := math.Modf(n)
+
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), true
+	}
+
+	return now.Add(time.Duration(max(n, 0) * float64(time.Second))), true
+}
+
+// shouldRetry reports whether the request should be sent again after failing with err
+func (p *RetryPolicy) shouldRetry(ctx context.Context, r *Request, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if !p.RetryNonIdempotent && !r.idempotent() {
+		return false
+	}
+
+	if r.statusCode != 0 {
+		return r.statusCode != r.expectedStatusCode && p.RetryOnStatus(r.statusCode)
+	}
+
+	return p.RetryOnError(err)
+}
+
+// sleep waits for d or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,199 @@
+package gohans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	p := DefaultRetryPolicy()
+
+	assert.Equal(t, 3, p.MaxAttempts)
+	assert.Equal(t, 100*time.Millisecond, p.InitialBackoff)
+	assert.Equal(t, 5*time.Second, p.MaxBackoff)
+	assert.Equal(t, float64(2), p.Multiplier)
+	assert.Equal(t, FullJitter, p.Jitter)
+	assert.NotNil(t, p.RetryOnStatus)
+	assert.NotNil(t, p.RetryOnError)
+	assert.False(t, p.RetryNonIdempotent)
+}
+
+func TestRetryableStatus(t *testing.T) {
+	for _, code := range []int{408, 429, 500, 502, 503, 504, 599} {
+		assert.True(t, RetryableStatus(code), code)
+	}
+
+	for _, code := range []int{200, 301, 400, 401, 404, 409, 501, 505} {
+		assert.False(t, RetryableStatus(code), code)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", &url.Error{Op: "Get", URL: "http://localhost", Err: timeoutError{}}, true},
+		{"connection refused", &url.Error{Op: "Get", URL: "http://localhost", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"eof", &url.Error{Op: "Get", URL: "http://localhost", Err: io.EOF}, true},
+		{"unsupported scheme", &url.Error{Op: "Get", URL: "w://localhost", Err: errors.New(`unsupported protocol scheme "w"`)}, false},
+		{"canceled", &url.Error{Op: "Get", URL: "http://localhost", Err: context.Canceled}, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"missing url", MissingURLError, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, RetryableError(tt.err))
+		})
+	}
+}
+
+func TestRetryPolicy_withDefaults(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, Multiplier: 0.5}.withDefaults()
+
+	assert.Equal(t, 5, p.MaxAttempts)
+	assert.Equal(t, defaultInitialBackoff, p.InitialBackoff)
+	assert.Equal(t, defaultMaxBackoff, p.MaxBackoff)
+	assert.Equal(t, float64(defaultMultiplier), p.Multiplier)
+	assert.NotNil(t, p.RetryOnStatus)
+	assert.NotNil(t, p.RetryOnError)
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	t.Run("no jitter", func(t *testing.T) {
+		p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: NoJitter}.withDefaults()
+
+		assert.Equal(t, 100*time.Millisecond, p.backoff(1, 0))
+		assert.Equal(t, 200*time.Millisecond, p.backoff(2, 0))
+		assert.Equal(t, 400*time.Millisecond, p.backoff(3, 0))
+		assert.Equal(t, 800*time.Millisecond, p.backoff(4, 0))
+		assert.Equal(t, time.Second, p.backoff(5, 0))
+		assert.Equal(t, time.Second, p.backoff(100, 0))
+	})
+
+	t.Run("full jitter", func(t *testing.T) {
+		p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: FullJitter}.withDefaults()
+
+		for i := 0; i < 100; i++ {
+			d := p.backoff(3, 0)
+			assert.GreaterOrEqual(t, d, time.Duration(0))
+			assert.LessOrEqual(t, d, 400*time.Millisecond)
+		}
+	})
+
+	t.Run("decorrelated jitter", func(t *testing.T) {
+		p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: DecorrelatedJitter}.withDefaults()
+
+		var prev time.Duration
+		for i := 1; i < 100; i++ {
+			d := p.backoff(i, prev)
+			assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+			assert.LessOrEqual(t, d, max(3*prev, time.Second))
+			assert.LessOrEqual(t, d, time.Second)
+			prev = d
+		}
+	})
+}
+
+func Test_retryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{"seconds", 429, http.Header{"Retry-After": {"3"}}, 3 * time.Second, true},
+		{"http date", 503, http.Header{"Retry-After": {"Mon, 01 Jan 2024 12:00:10 GMT"}}, 10 * time.Second, true},
+		{"date in the past", 503, http.Header{"Retry-After": {"Mon, 01 Jan 2024 11:00:00 GMT"}}, 0, true},
+		{"rate limit reset seconds", 429, http.Header{"X-Ratelimit-Reset": {"7"}}, 7 * time.Second, true},
+		{"rate limit reset timestamp", 429, http.Header{"X-Ratelimit-Reset": {fmt.Sprint(now.Add(20 * time.Second).Unix())}}, 20 * time.Second, true},
+		{"rate limit reset fraction", 429, http.Header{"X-Ratelimit-Reset": {"0.5"}}, 500 * time.Millisecond, true},
+		{"retry after wins", 429, http.Header{"Retry-After": {"1"}, "X-Ratelimit-Reset": {"7"}}, time.Second, true},
+		{"invalid", 429, http.Header{"Retry-After": {"soon"}}, 0, false},
+		{"invalid reset", 429, http.Header{"X-Ratelimit-Reset": {"soon"}}, 0, false},
+		{"no header", 503, http.Header{}, 0, false},
+		{"other status", 500, http.Header{"Retry-After": {"3"}}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := retryAfter(tt.status, tt.header, now)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRetryPolicy_shouldRetry(t *testing.T) {
+	ctx := context.Background()
+	p := DefaultRetryPolicy()
+
+	t.Run("retryable status", func(t *testing.T) {
+		r := NewRequest()
+		r.statusCode = 503
+		assert.True(t, p.shouldRetry(ctx, r, UnexpectedStatusCodeError))
+	})
+
+	t.Run("client error status", func(t *testing.T) {
+		r := NewRequest()
+		r.statusCode = 400
+		assert.False(t, p.shouldRetry(ctx, r, UnexpectedStatusCodeError))
+	})
+
+	t.Run("expected status with decoding error", func(t *testing.T) {
+		r := NewRequest()
+		r.statusCode = 200
+		assert.False(t, p.shouldRetry(ctx, r, io.ErrUnexpectedEOF))
+	})
+
+	t.Run("non idempotent method", func(t *testing.T) {
+		r := NewRequest().SetMethod("POST")
+		r.statusCode = 503
+		assert.False(t, p.shouldRetry(ctx, r, UnexpectedStatusCodeError))
+
+		np := *p
+		np.RetryNonIdempotent = true
+		assert.True(t, np.shouldRetry(ctx, r, UnexpectedStatusCodeError))
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		r := NewRequest()
+		r.statusCode = 503
+		assert.False(t, p.shouldRetry(ctx, r, UnexpectedStatusCodeError))
+	})
+}
+
+func Test_sleep(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, sleep(ctx, time.Millisecond))
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, sleep(ctx, time.Hour), context.Canceled)
+}
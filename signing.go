@@ -0,0 +1,295 @@
+package gohans
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// UnsignedPayload replaces the body hash of SigV4 requests signed with SigV4.UnsignedPayload
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	sigV4Algorithm   = "AWS4-HMAC-SHA256"
+	hmacAlgorithm    = "HMAC-SHA256"
+	signingTimestamp = "20060102T150405Z"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty body
+var emptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// unsignedHeaders are left out of signatures, as proxies and the transport may change them
+var unsignedHeaders = map[string]bool{
+	"authorization":   true,
+	"user-agent":      true,
+	"x-amzn-trace-id": true,
+	"expect":          true,
+	"retry-count":     true,
+}
+
+// SigV4 signs requests with AWS Signature Version 4
+// Every header set when the request is sent is signed, except Authorization, User-Agent and Expect
+type SigV4 struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	Service         string
+	// UnsignedPayload signs UNSIGNED-PAYLOAD instead of the body hash, so streamed bodies can be sent to S3
+	UnsignedPayload bool
+	// Now returns the signing time, time.Now when nil
+	Now func() time.Time
+}
+
+func (s SigV4) Authenticate(req *http.Request) error {
+	now := signingTime(s.Now)
+	date := now.Format(signingTimestamp)
+
+	req.Header.Set("X-Amz-Date", date)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	payload := UnsignedPayload
+	if !s.UnsignedPayload {
+		var err error
+		if payload, err = payloadHash(req); err != nil {
+			return fmt.Errorf("sigv4: %w", err)
+		}
+	}
+
+	if s.Service == "s3" || s.UnsignedPayload {
+		req.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+
+	// S3 object keys are signed as sent, other services sign the normalized path escaped once more
+	canonical, signed := canonicalRequest(req, payload, s.Service != "s3")
+	scope := strings.Join([]string{date[:8], s.Region, s.Service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{sigV4Algorithm, date, scope, hashHex(canonical)}, "\n")
+
+	key := []byte("AWS4" + s.SecretAccessKey)
+	for _, part := range []string{date[:8], s.Region, s.Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.AccessKeyID, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+
+	return nil
+}
+
+// Challenge reports false, the signature is computed from fixed credentials
+func (s SigV4) Challenge(*http.Response) bool {
+	return false
+}
+
+// HMACSigner signs requests with HMAC-SHA256, for services using their own flavor of AWS style signatures
+// It sets the X-Date and X-Content-Sha256 headers, then signs the string
+//
+//	HMAC-SHA256\n<X-Date>\n<hex SHA-256 of the canonical request>
+//
+// The canonical request is built like the SigV4 one, from the method, path, sorted query, signed headers and body hash.
+// The signature is sent as Authorization: HMAC-SHA256 KeyId=<KeyID>, SignedHeaders=<headers>, Signature=<hex>
+type HMACSigner struct {
+	KeyID  string
+	Secret []byte
+	// Headers are the headers covered by the signature besides Host, X-Date and X-Content-Sha256, all of them when empty
+	Headers []string
+	// Now returns the signing time, time.Now when nil
+	Now func() time.Time
+}
+
+func (s HMACSigner) Authenticate(req *http.Request) error {
+	payload, err := payloadHash(req)
+	if err != nil {
+		return fmt.Errorf("hmac signature: %w", err)
+	}
+
+	date := signingTime(s.Now).Format(signingTimestamp)
+	req.Header.Set("X-Date", date)
+	req.Header.Set("X-Content-Sha256", payload)
+
+	signing := req
+	if len(s.Headers) > 0 {
+		// Only the configured headers are passed on to the canonical request
+		signing = &http.Request{Method: req.Method, URL: req.URL, Host: req.Host, Header: http.Header{}}
+		for _, h := range append([]string{"X-Date", "X-Content-Sha256"}, s.Headers...) {
+			if v := req.Header.Values(h); len(v) > 0 {
+				signing.Header[http.CanonicalHeaderKey(h)] = v
+			}
+		}
+	}
+
+	canonical, signed := canonicalRequest(signing, payload, false)
+	toSign := strings.Join([]string{hmacAlgorithm, date, hashHex(canonical)}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s KeyId=%s, SignedHeaders=%s, Signature=%s",
+		hmacAlgorithm, s.KeyID, signed, hex.EncodeToString(hmacSHA256(s.Secret, toSign))))
+
+	return nil
+}
+
+// Challenge reports false, the signature is computed from fixed credentials
+func (s HMACSigner) Challenge(*http.Response) bool {
+	return false
+}
+
+func signingTime(now func() time.Time) time.Time {
+	if now == nil {
+		return time.Now().UTC()
+	}
+
+	return now().UTC()
+}
+
+// payloadHash returns the hex SHA-256 of the request body
+func payloadHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return emptyPayloadHash, nil
+	}
+
+	sum, err := bodySum(req, sha256.New())
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(sum), nil
+}
+
+// bodySum hashes the request body, read from a copy so the body can still be sent
+func bodySum(req *http.Request, h hash.Hash) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return h.Sum(nil), nil
+	}
+
+	if req.GetBody == nil {
+		return nil, BodyNotRewindableError
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(h, body)
+	body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Rewindable readers share their position with the copy, so the request gets a fresh body
+	if req.Body, err = req.GetBody(); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// canonicalRequest returns the SigV4 canonical request and the list of signed headers
+func canonicalRequest(req *http.Request, payload string, escapePath bool) (string, string) {
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+
+	if escapePath {
+		clean := path.Clean(uri)
+		if strings.HasSuffix(uri, "/") && clean != "/" {
+			clean += "/"
+		}
+
+		uri = escapeSegments(clean)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string][]string{"host": {stripDefaultPort(req.URL.Scheme, host)}}
+	for k, v := range req.Header {
+		if name := strings.ToLower(k); !unsignedHeaders[name] {
+			headers[name] = append(headers[name], v...)
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		values := make([]string, len(headers[name]))
+		for i, v := range headers[name] {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+
+		canonicalHeaders.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+
+	signed := strings.Join(names, ";")
+
+	return strings.Join([]string{
+		req.Method, uri, canonicalQuery(req.URL), canonicalHeaders.String(), signed, payload,
+	}, "\n"), signed
+}
+
+// canonicalQuery returns the query sorted by key and value, with spaces escaped as %20
+func canonicalQuery(u *url.URL) string {
+	q := u.Query()
+	for _, v := range q {
+		sort.Strings(v)
+	}
+
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// escapeSegments escapes each segment of an escaped path once more, keeping only unreserved characters
+func escapeSegments(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
+
+func stripDefaultPort(scheme, host string) string {
+	if (scheme == "http" && strings.HasSuffix(host, ":80")) || (scheme == "https" && strings.HasSuffix(host, ":443")) {
+		return host[:strings.LastIndexByte(host, ':')]
+	}
+
+	return host
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
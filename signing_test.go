@@ -0,0 +1,183 @@
+package gohans
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigV4(t *testing.T) {
+	// Vectors of the AWS Signature Version 4 test suite
+	signer := SigV4{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+		Now:             func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) },
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		body      string
+		headers   http.Header
+		signed    string
+		signature string
+	}{
+		{
+			name:      "get-vanilla",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/",
+			signed:    "host;x-amz-date",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:      "get-vanilla-query-order-key-case",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			signed:    "host;x-amz-date",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:      "post-vanilla",
+			method:    http.MethodPost,
+			url:       "https://example.amazonaws.com/",
+			signed:    "host;x-amz-date",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:      "post-x-www-form-urlencoded",
+			method:    http.MethodPost,
+			url:       "https://example.amazonaws.com/",
+			body:      "Param1=value1",
+			headers:   http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			signed:    "content-type;host;x-amz-date",
+			signature: "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			req, _ := http.NewRequest(tt.method, tt.url, body)
+			for k, v := range tt.headers {
+				req.Header[k] = v
+			}
+
+			assert.NoError(t, signer.Authenticate(req))
+			assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+				"SignedHeaders="+tt.signed+", Signature="+tt.signature, req.Header.Get("Authorization"))
+			assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+
+			// The body is still sent in full
+			if tt.body != "" {
+				b, _ := io.ReadAll(req.Body)
+				assert.Equal(t, tt.body, string(b))
+			}
+		})
+	}
+
+	t.Run("session token", func(t *testing.T) {
+		s := signer
+		s.SessionToken = "token"
+
+		req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+		assert.NoError(t, s.Authenticate(req))
+		assert.Equal(t, "token", req.Header.Get("X-Amz-Security-Token"))
+		assert.Contains(t, req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,")
+	})
+
+	t.Run("streamed body", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "https://bucket.s3.amazonaws.com/key", io.NopCloser(strings.NewReader("data")))
+		assert.ErrorIs(t, signer.Authenticate(req), BodyNotRewindableError)
+
+		s := signer
+		s.Service = "s3"
+		s.UnsignedPayload = true
+		assert.NoError(t, s.Authenticate(req))
+		assert.Equal(t, UnsignedPayload, req.Header.Get("X-Amz-Content-Sha256"))
+	})
+}
+
+func Test_canonicalRequest(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com:80/a/./b/../c%20d/?b=2&a=1&a=0&s=x%20y", nil)
+	req.Header.Set("X-Multi", "  one   two ")
+	req.Header.Add("X-Multi", "three")
+	req.Header.Set("User-Agent", "gohans")
+
+	canonical, signed := canonicalRequest(req, emptyPayloadHash, true)
+	assert.Equal(t, "host;x-multi", signed)
+	assert.Equal(t, strings.Join([]string{
+		"GET",
+		"/a/c%2520d/",
+		"a=0&a=1&b=2&s=x%20y",
+		"host:example.com",
+		"x-multi:one two,three",
+		"",
+		"host;x-multi",
+		emptyPayloadHash,
+	}, "\n"), canonical)
+
+	// S3 paths are signed as sent
+	canonical, _ = canonicalRequest(req, emptyPayloadHash, false)
+	assert.Contains(t, canonical, "\n/a/./b/../c%20d/\n")
+}
+
+func TestHMACSigner(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("s3cret")
+	now := func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	// The server recomputes the signature from the request it received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"name":"gohans"}`+"\n", string(body))
+
+		received := r.Clone(r.Context())
+		received.URL.Host = r.Host
+		received.Body = io.NopCloser(bytes.NewReader(body))
+		received.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		received.Header.Del("Authorization")
+
+		expected := received.Clone(ctx)
+		assert.NoError(t, HMACSigner{KeyID: "key-1", Secret: secret, Headers: []string{"Content-Type"}, Now: now}.Authenticate(expected))
+
+		if r.Header.Get("Authorization") != expected.Header.Get("Authorization") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(ctx, WithAuthenticator(HMACSigner{KeyID: "key-1", Secret: secret, Headers: []string{"Content-Type"}, Now: now}))
+
+	r := NewRequest().
+		SetMethod(http.MethodPost).
+		SetURL(server.URL+"/items?b=2&a=1").
+		SetHeader("X-Unsigned", "changed by a proxy").
+		SetRequestBody(map[string]string{"name": "gohans"})
+
+	_, err := r.Send(ctx, client)
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	assert.NoError(t, HMACSigner{KeyID: "key-1", Secret: secret, Now: now}.Authenticate(req))
+	assert.Equal(t, "20240102T030405Z", req.Header.Get("X-Date"))
+	assert.Equal(t, emptyPayloadHash, req.Header.Get("X-Content-Sha256"))
+	assert.Regexp(t, `^HMAC-SHA256 KeyId=key-1, SignedHeaders=host;x-content-sha256;x-date, Signature=[0-9a-f]{64}$`, req.Header.Get("Authorization"))
+}
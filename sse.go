@@ -0,0 +1,283 @@
+package gohans
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EventStreamContentType = "text/event-stream"
+
+	// DefaultEventRetry is the reconnection delay used until the server sends a retry field
+	DefaultEventRetry = 3 * time.Second
+	// maxEventLineSize is the longest line accepted in an event stream
+	maxEventLineSize = 1 << 20
+)
+
+// Event is a server-sent event
+type Event struct {
+	// ID is the last event ID seen on the stream, sent back as Last-Event-ID when reconnecting
+	ID string
+	// Event is the event type, message when the server did not name it
+	Event string
+	Data  string
+	// Retry is the reconnection delay sent with the event, zero if none
+	Retry time.Duration
+}
+
+// TypedEvent is a server-sent event with its data decoded
+type TypedEvent[T any] struct {
+	Event
+	Value T
+}
+
+// Events opens an event stream for the request and returns an iterator over its events
+// The stream is reconnected with the Last-Event-ID header when it ends or fails, after the delay of the last
+// retry field or DefaultEventRetry; connection errors are yielded before reconnecting, so stopping the iteration
+// gives up. Unexpected status codes and content types end the iteration after yielding the error, and so does a
+// 204 No Content response, without an error. Canceling the context ends the iteration
+func (c *Client) Events(ctx context.Context, r *Request) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		s := &eventStream{client: c, request: r, retry: DefaultEventRetry}
+
+		for {
+			done, err := s.connect(ctx, yield)
+			if done || ctx.Err() != nil {
+				return
+			}
+
+			if err != nil && !yield(Event{}, err) {
+				return
+			}
+
+			c.logger.Warn("reconnecting event stream", "wait", s.retry, "last_event_id", s.lastEventID, "error", err)
+
+			if sleep(ctx, s.retry) != nil {
+				return
+			}
+		}
+	}
+}
+
+// DecodeEvents opens an event stream like Client.Events and decodes the data of each event into T
+// Data is decoded by the client codec for the request Content-Type, JSON by default
+// A decoding error is yielded with the raw event and does not end the iteration
+func DecodeEvents[T any](ctx context.Context, c *Client, r *Request) iter.Seq2[TypedEvent[T], error] {
+	return func(yield func(TypedEvent[T], error) bool) {
+		codec, ok := c.codecs.lookup(c.requestHeader(r).Get("Content-Type"))
+		if !ok {
+			codec = JSONCodec{}
+		}
+
+		for ev, err := range c.Events(ctx, r) {
+			te := TypedEvent[T]{Event: ev}
+			if err == nil {
+				if derr := codec.Decode(strings.NewReader(ev.Data), &te.Value); derr != nil {
+					err = fmt.Errorf("event %q: %w", ev.ID, derr)
+				}
+			}
+
+			if !yield(te, err) {
+				return
+			}
+		}
+	}
+}
+
+// eventStream holds the state kept across the connections of an event stream
+type eventStream struct {
+	client      *Client
+	request     *Request
+	lastEventID string
+	retry       time.Duration
+}
+
+// connect reads events from a single connection until it ends
+// It reports done when the iteration must end, either because the consumer stopped or the server refused the stream
+func (s *eventStream) connect(ctx context.Context, yield func(Event, error) bool) (done bool, err error) {
+	r := s.request
+	r.SetHeader("Accept", EventStreamContentType)
+	r.SetHeader("Cache-Control", "no-cache")
+	if s.lastEventID != "" {
+		r.SetHeader("Last-Event-ID", s.lastEventID)
+	}
+
+	req, err := s.client.newHTTPRequest(ctx, r)
+	if err != nil {
+		yield(Event{}, err)
+
+		return true, nil
+	}
+
+	resp, err := s.client.roundTrip(r, req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	r.statusCode = resp.StatusCode
+	r.responseHeader = resp.Header
+
+	if resp.StatusCode == http.StatusNoContent {
+		return true, nil
+	}
+
+	if resp.StatusCode != r.expectedStatusCode {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		yield(Event{}, s.client.statusError(r, req, resp, body))
+
+		return true, nil
+	}
+
+	if mt := mediaType(resp.Header.Get("Content-Type")); mt != EventStreamContentType {
+		yield(Event{}, fmt.Errorf("%w: %s", InvalidContentTypeError, mt))
+
+		return true, nil
+	}
+
+	er := newEventReader(resp.Body, s.lastEventID)
+	defer func() {
+		s.lastEventID = er.lastEventID
+		if er.retry > 0 {
+			s.retry = er.retry
+		}
+	}()
+
+	for {
+		ev, err := er.next()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+
+			return false, err
+		}
+
+		if !yield(ev, nil) {
+			return true, nil
+		}
+	}
+}
+
+// eventReader parses an event stream as specified by the HTML living standard
+type eventReader struct {
+	scanner *bufio.Scanner
+	first   bool
+	// id is the id field being read, it becomes the last event ID when the event ends
+	id          string
+	lastEventID string
+	// retry is the last reconnection delay sent by the server, zero if none
+	retry time.Duration
+}
+
+// newEventReader returns a reader for a stream, continuing from the last event ID of a previous connection
+func newEventReader(r io.Reader, lastEventID string) *eventReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxEventLineSize)
+	scanner.Split(scanEventLines)
+
+	return &eventReader{scanner: scanner, first: true, id: lastEventID, lastEventID: lastEventID}
+}
+
+// next returns the next complete event, or io.EOF at the end of the stream
+// An event cut off by the end of the stream is discarded
+func (er *eventReader) next() (Event, error) {
+	var data strings.Builder
+	var hasData bool
+	ev := Event{}
+
+	for er.scanner.Scan() {
+		line := er.scanner.Text()
+		if er.first {
+			line = strings.TrimPrefix(line, "\uFEFF")
+			er.first = false
+		}
+
+		if line == "" {
+			er.lastEventID = er.id
+
+			if !hasData {
+				ev = Event{}
+				continue
+			}
+
+			ev.ID = er.lastEventID
+			ev.Data = strings.TrimSuffix(data.String(), "\n")
+			if ev.Event == "" {
+				ev.Event = "message"
+			}
+
+			return ev, nil
+		}
+
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			ev.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				er.id = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				ev.Retry = time.Duration(ms) * time.Millisecond
+				er.retry = ev.Retry
+			}
+		}
+	}
+
+	if err := er.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+
+	return Event{}, io.EOF
+}
+
+// scanEventLines splits lines ending with CRLF, LF or CR
+func scanEventLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+
+		// A CR at the end of the buffer may be followed by a LF
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+
+		return i + 1, data[:i], nil
+	}
+
+	// A last line without a line ending does not complete an event, it is dropped
+	if atEOF {
+		return len(data), nil, nil
+	}
+
+	return 0, nil, nil
+}
@@ -0,0 +1,217 @@
+package gohans
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_eventReader(t *testing.T) {
+	t.Run("parse stream", func(t *testing.T) {
+		stream := "\uFEFF: comment\n" +
+			"data: first\n\n" +
+			"event: update\r\nid: 1\r\ndata: line one\r\ndata:line two\r\n\r\n" +
+			"retry: 250\rdata: third\r\r" +
+			"id: 2\n\n" +
+			"id: bad\x00\ndata\ndata\n\n" +
+			"retry: soon\ndata: cut off"
+
+		er := newEventReader(strings.NewReader(stream), "")
+
+		var events []Event
+		for {
+			ev, err := er.next()
+			if err == io.EOF {
+				break
+			}
+
+			assert.NoError(t, err)
+			events = append(events, ev)
+		}
+
+		assert.Equal(t, []Event{
+			{Event: "message", Data: "first"},
+			{ID: "1", Event: "update", Data: "line one\nline two"},
+			{ID: "1", Event: "message", Data: "third", Retry: 250 * time.Millisecond},
+			{ID: "2", Event: "message", Data: "\n"},
+		}, events)
+		assert.Equal(t, "2", er.lastEventID)
+		assert.Equal(t, 250*time.Millisecond, er.retry)
+	})
+
+	t.Run("continue from last event id", func(t *testing.T) {
+		er := newEventReader(strings.NewReader("data: x\n\n"), "7")
+
+		ev, err := er.next()
+		assert.NoError(t, err)
+		assert.Equal(t, "7", ev.ID)
+	})
+
+	t.Run("line too long", func(t *testing.T) {
+		er := newEventReader(strings.NewReader("data: "+strings.Repeat("x", maxEventLineSize)+"\n\n"), "")
+
+		_, err := er.next()
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_Events(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+
+	t.Run("reconnect with last event id", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, EventStreamContentType, r.Header.Get("Accept"))
+
+			switch calls.Add(1) {
+			case 1:
+				assert.Empty(t, r.Header.Get("Last-Event-ID"))
+				w.Header().Set("Content-Type", EventStreamContentType)
+				fmt.Fprint(w, "retry: 10\n\nid: 1\ndata: one\n\nid: 2\ndata: two\n\n")
+			case 2:
+				assert.Equal(t, "2", r.Header.Get("Last-Event-ID"))
+				w.Header().Set("Content-Type", EventStreamContentType+"; charset=utf-8")
+				fmt.Fprint(w, "id: 3\nevent: last\ndata: three\n\n")
+			default:
+				assert.Equal(t, "3", r.Header.Get("Last-Event-ID"))
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer server.Close()
+
+		var data []string
+		for ev, err := range client.Events(ctx, NewRequest().SetURL(server.URL)) {
+			assert.NoError(t, err)
+			data = append(data, ev.ID+":"+ev.Event+":"+ev.Data)
+		}
+
+		assert.Equal(t, []string{"1:message:one", "2:message:two", "3:last:three"}, data)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("stop iteration", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", EventStreamContentType)
+			fmt.Fprint(w, "data: one\n\ndata: two\n\n")
+		}))
+		defer server.Close()
+
+		var count int
+		for range client.Events(ctx, NewRequest().SetURL(server.URL)) {
+			count++
+			break
+		}
+
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("unexpected status code", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "unauthorized"}`))
+		}))
+		defer server.Close()
+
+		var errs []error
+		for _, err := range client.Events(ctx, NewRequest().SetURL(server.URL)) {
+			errs = append(errs, err)
+		}
+
+		assert.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], UnexpectedStatusCodeError)
+	})
+
+	t.Run("unexpected content type", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", JSONContentType)
+			w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		var errs []error
+		for _, err := range client.Events(ctx, NewRequest().SetURL(server.URL)) {
+			errs = append(errs, err)
+		}
+
+		assert.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], InvalidContentTypeError)
+	})
+
+	t.Run("connection error", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		for _, err := range client.Events(ctx, NewRequest().SetURL(server.URL)) {
+			assert.Error(t, err)
+			break
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", EventStreamContentType)
+			fmt.Fprint(w, "data: one\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var count int
+		for _, err := range client.Events(ctx, NewRequest().SetURL(server.URL)) {
+			if err == nil {
+				count++
+				cancel()
+			}
+		}
+
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestDecodeEvents(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(ctx)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Last-Event-ID") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", EventStreamContentType)
+		fmt.Fprint(w, "retry: 1\nid: 1\ndata: {\"status\": \"ok\"}\n\nid: 2\ndata: not json\n\nid: 3\ndata: {\"status\":\ndata: \"done\"}\n\n")
+	}))
+	defer server.Close()
+
+	type status struct {
+		Status string `json:"status"`
+	}
+
+	var values []string
+	var errs int
+	for ev, err := range DecodeEvents[status](ctx, client, NewRequest().SetURL(server.URL)) {
+		if err != nil {
+			assert.Equal(t, "2", ev.ID)
+			errs++
+
+			continue
+		}
+
+		values = append(values, ev.Value.Status)
+	}
+
+	assert.Equal(t, []string{"ok", "done"}, values)
+	assert.Equal(t, 1, errs)
+}
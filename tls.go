@@ -0,0 +1,155 @@
+package gohans
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var NoCertificatesError = errors.New("no certificates found in CA bundle")
+
+// CertificateFiles are the PEM files of a mutual TLS client
+type CertificateFiles struct {
+	// CACert is the CA bundle used to verify servers, the system roots are used when empty
+	CACert string
+	// Cert and Key are the client certificate chain and private key, no client certificate is sent when empty
+	Cert string
+	Key  string
+	// ReloadInterval checks the certificate and key files for changes, they are loaded once when zero
+	ReloadInterval time.Duration
+	// OnReloadError is called when changed files cannot be loaded, the previous certificate is kept
+	OnReloadError func(error)
+}
+
+// NewTLSConfig loads the CA bundle and the client certificate and key into a TLS config
+func NewTLSConfig(ctx context.Context, caCertPath, certPath, keyPath string) (*tls.Config, error) {
+	return CertificateFiles{CACert: caCertPath, Cert: certPath, Key: keyPath}.TLSConfig(ctx)
+}
+
+// TLSConfig loads the files into a TLS config
+// With a ReloadInterval the client certificate is reloaded when its files change, until ctx is done.
+// New connections use the reloaded certificate, the CA bundle is only loaded once.
+func (f CertificateFiles) TLSConfig(ctx context.Context) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if f.CACert != "" {
+		pem, err := os.ReadFile(f.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: %w", f.CACert, NoCertificatesError)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if f.Cert == "" && f.Key == "" {
+		return cfg, nil
+	}
+
+	r := &certReloader{certPath: f.Cert, keyPath: f.Key}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	cfg.GetClientCertificate = r.clientCertificate
+
+	if f.ReloadInterval > 0 {
+		go r.watch(ctx, f.ReloadInterval, f.OnReloadError)
+	}
+
+	return cfg, nil
+}
+
+// WithClientCertificateFiles sets a TLS config loaded from the files on the http client
+func WithClientCertificateFiles(ctx context.Context, files CertificateFiles) RequestOption {
+	return func(c *Client) {
+		cfg, err := files.TLSConfig(ctx)
+		if err != nil {
+			c.err = err
+			return
+		}
+
+		WithTLSClientConfig(cfg)(c)
+	}
+}
+
+// certReloader serves the latest client certificate loaded from disk
+type certReloader struct {
+	certPath string
+	keyPath  string
+
+	cert     atomic.Pointer[tls.Certificate]
+	modified [2]time.Time
+}
+
+func (r *certReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+func (r *certReloader) load() error {
+	modified, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("load client certificate: %w", err)
+	}
+
+	r.cert.Store(&cert)
+	r.modified = modified
+
+	return nil
+}
+
+// watch reloads the certificate when the modification time of either file changes
+func (r *certReloader) watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modified, err := r.modTimes()
+		if err == nil && modified == r.modified {
+			continue
+		}
+
+		// A failed load is retried on the next tick, the files may be halfway through being replaced
+		if err == nil {
+			err = r.load()
+		}
+
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (r *certReloader) modTimes() ([2]time.Time, error) {
+	var modified [2]time.Time
+	for i, name := range []string{r.certPath, r.keyPath} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modified, fmt.Errorf("load client certificate: %w", err)
+		}
+
+		modified[i] = info.ModTime()
+	}
+
+	return modified, nil
+}
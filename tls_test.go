@@ -0,0 +1,150 @@
+package gohans
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madflojo/testcerts"
+	"github.com/stretchr/testify/assert"
+)
+
+// mtlsServer requires client certificates signed by the CA and answers with the DNS name of the client certificate
+func mtlsServer(t *testing.T, ca *testcerts.CertificateAuthority) *httptest.Server {
+	kp, err := ca.NewKeyPair()
+	assert.NoError(t, err)
+
+	cert, err := tls.X509KeyPair(kp.PublicKey(), kp.PrivateKey())
+	assert.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", JSONContentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`"` + r.TLS.PeerCertificates[0].DNSNames[0] + `"`))
+	}))
+
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.CertPool(),
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// writeKeyPair writes a client certificate for name, moving the modification time forward
+func writeKeyPair(t *testing.T, ca *testcerts.CertificateAuthority, certPath, keyPath, name string, modified time.Time) {
+	kp, err := ca.NewKeyPair(name)
+	assert.NoError(t, err)
+	assert.NoError(t, kp.ToFile(certPath, keyPath))
+	assert.NoError(t, os.Chtimes(certPath, modified, modified))
+	assert.NoError(t, os.Chtimes(keyPath, modified, modified))
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	ca := testcerts.NewCA()
+	server := mtlsServer(t, ca)
+
+	caPath, certPath, keyPath := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	assert.NoError(t, ca.ToFile(caPath, filepath.Join(dir, "ca.key")))
+	writeKeyPair(t, ca, certPath, keyPath, "client-1", time.Now())
+
+	t.Run("mutual TLS", func(t *testing.T) {
+		tlsc, err := NewTLSConfig(ctx, caPath, certPath, keyPath)
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(tls.VersionTLS12), tlsc.MinVersion)
+
+		var name string
+		_, err = NewRequest().SetURL(server.URL).SetWantedResponseBody(&name).Send(ctx, NewClient(ctx, WithTLSClientConfig(tlsc)))
+		assert.NoError(t, err)
+		assert.Equal(t, "client-1", name)
+	})
+
+	t.Run("without client certificate", func(t *testing.T) {
+		tlsc, err := NewTLSConfig(ctx, caPath, "", "")
+		assert.NoError(t, err)
+
+		_, err = NewRequest().SetURL(server.URL).Send(ctx, NewClient(ctx, WithTLSClientConfig(tlsc)))
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid files", func(t *testing.T) {
+		_, err := NewTLSConfig(ctx, filepath.Join(dir, "missing.pem"), certPath, keyPath)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		_, err = NewTLSConfig(ctx, keyPath, certPath, keyPath)
+		assert.ErrorIs(t, err, NoCertificatesError)
+
+		_, err = NewTLSConfig(ctx, caPath, certPath, caPath)
+		assert.ErrorContains(t, err, "load client certificate")
+
+		client := NewClient(ctx, WithClientCertificateFiles(ctx, CertificateFiles{CACert: caPath, Cert: certPath, Key: filepath.Join(dir, "missing.key")}))
+		_, err = NewRequest().SetURL(server.URL).Send(ctx, client)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestWithClientCertificateFiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	ca := testcerts.NewCA()
+	server := mtlsServer(t, ca)
+
+	caPath, certPath, keyPath := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	assert.NoError(t, ca.ToFile(caPath, filepath.Join(dir, "ca.key")))
+
+	modified := time.Now().Add(-time.Hour)
+	writeKeyPair(t, ca, certPath, keyPath, "client-1", modified)
+
+	var mu sync.Mutex
+	var reloadErrors []error
+
+	client := NewClient(ctx, WithClientCertificateFiles(ctx, CertificateFiles{
+		CACert:         caPath,
+		Cert:           certPath,
+		Key:            keyPath,
+		ReloadInterval: 10 * time.Millisecond,
+		OnReloadError: func(err error) {
+			mu.Lock()
+			reloadErrors = append(reloadErrors, err)
+			mu.Unlock()
+		},
+	}))
+
+	clientName := func() string {
+		// Only new connections present the reloaded certificate
+		client.httpClient.CloseIdleConnections()
+
+		var name string
+		_, err := NewRequest().SetURL(server.URL).SetWantedResponseBody(&name).Send(ctx, client)
+		assert.NoError(t, err)
+
+		return name
+	}
+
+	assert.Equal(t, "client-1", clientName())
+
+	writeKeyPair(t, ca, certPath, keyPath, "client-2", modified.Add(time.Minute))
+	assert.Eventually(t, func() bool { return clientName() == "client-2" }, 5*time.Second, 20*time.Millisecond)
+
+	// A broken key keeps the previous certificate in use
+	assert.NoError(t, os.WriteFile(keyPath, []byte("not a key"), 0o600))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reloadErrors) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "client-2", clientName())
+}